@@ -0,0 +1,259 @@
+package billplz
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// VerificationStatus represents the verification state of a bank account
+// registered through the API's Bank Account Direct Verification Service.
+type VerificationStatus string
+
+// Verification states reported by the Billplz API.
+const (
+	VerificationPending  VerificationStatus = "pending"
+	VerificationVerified VerificationStatus = "verified"
+	VerificationRejected VerificationStatus = "rejected"
+)
+
+// defaultVerificationInterval is the default delay between two checks of the
+// pending verifications tracked by a VerificationTracker.
+const defaultVerificationInterval = time.Hour
+
+// VerificationRecord represents the progress of a bank account verification
+// tracked by a VerificationTracker.
+type VerificationRecord struct {
+	AccountNumber     string             `json:"acc_no"`
+	Status            VerificationStatus `json:"status"`
+	RejectDescription string             `json:"reject_desc,omitempty"`
+	RegisteredAt      time.Time          `json:"registered_at"`
+	CheckedAt         time.Time          `json:"checked_at"`
+	Checks            int                `json:"checks"`
+}
+
+// VerificationStore persists the progress of bank account verifications
+// tracked by a VerificationTracker.
+type VerificationStore interface {
+	// Get returns the record for the given account number, or
+	// ErrVerificationNotFound if the account number is not tracked.
+	Get(ctx context.Context, accountNumber string) (*VerificationRecord, error)
+
+	// Save creates or replaces the record for the record's account number.
+	Save(ctx context.Context, record VerificationRecord) error
+
+	// Pending returns all records that are still pending verification.
+	Pending(ctx context.Context) ([]VerificationRecord, error)
+}
+
+// MemoryVerificationStore is a VerificationStore that keeps records in memory.
+// It is safe for concurrent use.
+type MemoryVerificationStore struct {
+	mu      sync.RWMutex
+	records map[string]VerificationRecord
+}
+
+// NewMemoryVerificationStore instantiates and returns an empty MemoryVerificationStore.
+func NewMemoryVerificationStore() *MemoryVerificationStore {
+	return &MemoryVerificationStore{records: make(map[string]VerificationRecord)}
+}
+
+// Get implements VerificationStore.
+func (s *MemoryVerificationStore) Get(ctx context.Context, accountNumber string) (*VerificationRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.records[accountNumber]
+	if !ok {
+		return nil, ErrVerificationNotFound
+	}
+	return &record, nil
+}
+
+// Save implements VerificationStore.
+func (s *MemoryVerificationStore) Save(ctx context.Context, record VerificationRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.AccountNumber] = record
+	return nil
+}
+
+// Pending implements VerificationStore.
+func (s *MemoryVerificationStore) Pending(ctx context.Context) ([]VerificationRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := []VerificationRecord{}
+	for _, record := range s.records {
+		if record.Status == VerificationPending {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].AccountNumber < records[j].AccountNumber
+	})
+	return records, nil
+}
+
+// VerificationEvent is passed to a VerificationTracker's callback when a
+// tracked bank account is verified or rejected.
+type VerificationEvent struct {
+	AccountNumber string
+	Status        VerificationStatus
+
+	// RejectDescription holds the reason given by Billplz when Status is
+	// VerificationRejected.
+	RejectDescription string
+
+	// BankAccount is the bank account returned by the API. It is nil if the
+	// status was determined with Client.CheckRegistration because the 'ADMIN'
+	// setting is not enabled.
+	BankAccount *BankAccount
+}
+
+// VerificationTracker registers bank accounts for verification, and polls the
+// API until each account is verified or rejected.
+// Progress is persisted in Store, so tracking survives restarts.
+// Without the 'ADMIN' setting, accounts are checked with Client.CheckRegistration
+// instead, which only tells verified accounts from unverified ones. Rejected
+// accounts cannot be detected that way, and remain pending until they are
+// removed from Store.
+type VerificationTracker struct {
+	Client *Client
+	Store  VerificationStore
+
+	// Interval is the delay between two checks of the pending verifications
+	// when running Run. Defaults to 1 hour.
+	Interval time.Duration
+
+	// OnChange is called when a tracked bank account is verified or rejected.
+	OnChange func(VerificationEvent)
+
+	// OnError, if set, is called by Run with the error of every check that
+	// fails.
+	OnError func(error)
+}
+
+// NewVerificationTracker instantiates and returns a new VerificationTracker.
+// If a store is not supplied, an in-memory store will be used.
+func NewVerificationTracker(client *Client, store VerificationStore, onChange func(VerificationEvent)) *VerificationTracker {
+	if store == nil {
+		store = NewMemoryVerificationStore()
+	}
+	return &VerificationTracker{
+		Client:   client,
+		Store:    store,
+		OnChange: onChange,
+	}
+}
+
+// Register creates a new bank account with Client.CreateBankAccount, and starts
+// tracking its verification.
+// An error will be returned if the bank account could not be created, or if
+// the record could not be saved.
+func (t *VerificationTracker) Register(ctx context.Context, b BankAccount) (*BankAccount, error) {
+	result, err := t.Client.createBankAccount(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	return result, t.Track(ctx, b.AccountNumber)
+}
+
+// Track starts tracking the verification of an existing bank account with the
+// given account number. Accounts that are already tracked are left untouched.
+func (t *VerificationTracker) Track(ctx context.Context, accountNumber string) error {
+	_, err := t.Store.Get(ctx, accountNumber)
+	if err == nil {
+		return nil
+	}
+	if err != ErrVerificationNotFound {
+		return err
+	}
+	return t.Store.Save(ctx, VerificationRecord{
+		AccountNumber: accountNumber,
+		Status:        VerificationPending,
+		RegisteredAt:  time.Now(),
+	})
+}
+
+// Run checks the pending verifications every Interval until ctx is done.
+// Errors from individual checks do not stop the tracker; they are passed to
+// OnError, and retried on the next run.
+func (t *VerificationTracker) Run(ctx context.Context) error {
+	interval := t.Interval
+	if interval <= 0 {
+		interval = defaultVerificationInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Poll(ctx); err != nil && ctx.Err() == nil && t.OnError != nil {
+			t.OnError(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Poll checks every pending verification once, saving their progress and
+// calling OnChange for accounts that were verified or rejected.
+// The returned error is the error of the first failed check, noting how many
+// other checks failed.
+func (t *VerificationTracker) Poll(ctx context.Context) error {
+	records, err := t.Store.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, record := range records {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := t.check(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+func (t *VerificationTracker) check(ctx context.Context, record VerificationRecord) error {
+	event := VerificationEvent{AccountNumber: record.AccountNumber}
+
+	account, err := t.Client.getBankAccount(ctx, record.AccountNumber)
+	switch err {
+	case nil:
+		event.BankAccount = account
+		event.Status = VerificationStatus(account.Status)
+		event.RejectDescription = account.RejectDescription
+	case ErrAdminPrivilegeRequired:
+		verified, err := t.Client.checkRegistration(ctx, record.AccountNumber)
+		if err != nil && err != ErrBankAccountNotFound {
+			return err
+		}
+		event.Status = VerificationPending
+		if verified {
+			event.Status = VerificationVerified
+		}
+	default:
+		return err
+	}
+
+	record.Checks++
+	record.CheckedAt = time.Now()
+	if event.Status == VerificationVerified || event.Status == VerificationRejected {
+		record.Status = event.Status
+		record.RejectDescription = event.RejectDescription
+	}
+	if err := t.Store.Save(ctx, record); err != nil {
+		return err
+	}
+
+	if record.Status != VerificationPending && t.OnChange != nil {
+		t.OnChange(event)
+	}
+	return nil
+}
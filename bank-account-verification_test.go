@@ -0,0 +1,213 @@
+package billplz
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// verificationServer serves each account's scripted statuses in turn, repeating
+// the last one, and responds 404 to unknown accounts. Without the 'ADMIN'
+// setting, the statuses are served through the registration check instead,
+// where "rejected" cannot be told from "pending".
+type verificationServer struct {
+	admin bool
+
+	mu       sync.Mutex
+	statuses map[string][]string
+	checks   map[string]int
+}
+
+func (s *verificationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v3/bank_verification_services":
+		w.Write([]byte(`{"acc_no":"123456789012","status":"pending"}`))
+	case strings.HasPrefix(r.URL.Path, "/v3/bank_verification_services/"):
+		if !s.admin {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"error":{"type":"Unauthorized","message":"Admin privilege required"}}`))
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/v3/bank_verification_services/")
+		status := s.next(id)
+		if status == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"acc_no":"` + id + `","status":"` + status + `","reject_desc":"` + rejectDescription(status) + `"}`))
+	case strings.HasPrefix(r.URL.Path, "/v3/check/bank_account_number/"):
+		name := "unverified"
+		if s.next(strings.TrimPrefix(r.URL.Path, "/v3/check/bank_account_number/")) == "verified" {
+			name = "verified"
+		}
+		w.Write([]byte(`{"name":"` + name + `"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *verificationServer) next(id string) string {
+	statuses := s.statuses[id]
+	if len(statuses) == 0 {
+		return ""
+	}
+	s.checks[id]++
+	if n := s.checks[id]; n <= len(statuses) {
+		return statuses[n-1]
+	}
+	return statuses[len(statuses)-1]
+}
+
+func rejectDescription(status string) string {
+	if status == "rejected" {
+		return "Name mismatch"
+	}
+	return ""
+}
+
+func TestVerificationTrackerPoll(t *testing.T) {
+	tests := []struct {
+		name       string
+		admin      bool
+		statuses   []string
+		polls      int
+		wantStatus VerificationStatus
+		wantEvent  bool
+	}{
+		{"verified", true, []string{"pending", "verified"}, 3, VerificationVerified, true},
+		{"rejected", true, []string{"pending", "rejected"}, 3, VerificationRejected, true},
+		{"pending", true, []string{"pending"}, 3, VerificationPending, false},
+		{"verified without admin", false, []string{"pending", "verified"}, 3, VerificationVerified, true},
+		{"rejected without admin", false, []string{"pending", "rejected"}, 3, VerificationPending, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &verificationServer{
+				admin:    tt.admin,
+				statuses: map[string][]string{"1234567890": tt.statuses},
+				checks:   make(map[string]int),
+			}
+			var events []VerificationEvent
+			tracker := NewVerificationTracker(newTestClient(t, s), nil, func(e VerificationEvent) {
+				events = append(events, e)
+			})
+			ctx := context.Background()
+
+			if err := tracker.Track(ctx, "1234567890"); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.polls; i++ {
+				if err := tracker.Poll(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			record, err := tracker.Store.Get(ctx, "1234567890")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", record.Status, tt.wantStatus)
+			}
+			wantChecks := tt.polls
+			if tt.wantEvent {
+				wantChecks = 2
+			}
+			if record.Checks != wantChecks {
+				t.Errorf("checked %d times, want %d", record.Checks, wantChecks)
+			}
+
+			if !tt.wantEvent {
+				if len(events) != 0 {
+					t.Errorf("OnChange called with %+v", events)
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Status != tt.wantStatus {
+				t.Fatalf("OnChange called with %+v, want one %s event", events, tt.wantStatus)
+			}
+			if (events[0].BankAccount != nil) != tt.admin {
+				t.Errorf("event has bank account %+v", events[0].BankAccount)
+			}
+			if tt.wantStatus == VerificationRejected && events[0].RejectDescription != "Name mismatch" {
+				t.Errorf("RejectDescription = %q", events[0].RejectDescription)
+			}
+		})
+	}
+}
+
+func TestVerificationTrackerRegister(t *testing.T) {
+	s := &verificationServer{admin: true, checks: make(map[string]int)}
+	tracker := NewVerificationTracker(newTestClient(t, s), nil, nil)
+	ctx := context.Background()
+
+	b := BankAccount{
+		Name:          "Insan Jaya",
+		IDNumber:      "910111-10-1111",
+		AccountNumber: "123456789012",
+		Code:          "MBBEMYKL",
+		Organization:  Bool(false),
+	}
+	if _, err := tracker.Register(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	record, err := tracker.Store.Get(ctx, "123456789012")
+	if err != nil || record.Status != VerificationPending {
+		t.Fatalf("Get() = %+v, %v, want a pending record", record, err)
+	}
+
+	record.Checks = 5
+	tracker.Store.Save(ctx, *record)
+	if err := tracker.Track(ctx, "123456789012"); err != nil {
+		t.Fatal(err)
+	}
+	if record, _ := tracker.Store.Get(ctx, "123456789012"); record.Checks != 5 {
+		t.Error("Track replaced the record of a tracked account")
+	}
+}
+
+func TestVerificationTrackerRun(t *testing.T) {
+	s := &verificationServer{admin: true, statuses: map[string][]string{"1": {"verified"}}, checks: make(map[string]int)}
+	errs := make(chan error, 10)
+	tracker := &VerificationTracker{
+		Client:   newTestClient(t, s),
+		Store:    NewMemoryVerificationStore(),
+		Interval: 5 * time.Millisecond,
+		OnError:  func(err error) { errs <- err },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tracker.Track(ctx, "1")
+	tracker.Track(ctx, "2") // fails on every check
+
+	done := make(chan error)
+	go func() { done <- tracker.Run(ctx) }()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusNotFound {
+				t.Errorf("OnError got %v, want a 404 *APIError", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("OnError was not called")
+		}
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() = %v, want context.Canceled", err)
+	}
+
+	if record, _ := tracker.Store.Get(context.Background(), "1"); record.Status != VerificationVerified {
+		t.Errorf("status of 1 = %s, want verified despite the failures of 2", record.Status)
+	}
+	if pending, _ := tracker.Store.Pending(context.Background()); len(pending) != 1 || pending[0].AccountNumber != "2" {
+		t.Errorf("Pending() = %+v, want 2 only", pending)
+	}
+}
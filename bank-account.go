@@ -1,39 +1,202 @@
 package billplz
 
 import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
 	"github.com/go-ozzo/ozzo-validation"
 )
 
 // BankAccount represents a bank account stored in the Billplz API.
+// Organization is a pointer, so that false can be sent explicitly. Use Bool to set it.
 type BankAccount struct {
 	Name              string `json:"name,omitempty"`
 	IDNumber          string `json:"id_no,omitempty"`
 	AccountNumber     string `json:"acc_no,omitempty"`
 	Code              string `json:"code,omitempty"`
-	Organization      bool   `json:"organization,omitempty"`
+	Organization      *bool  `json:"organization,omitempty"`
 	AuthorizationDate string `json:"authorization_date,omitempty"`
 	Status            string `json:"status,omitempty"`
 	ProcessedAt       string `json:"processed_at,omitempty"`
 	RejectDescription string `json:"reject_desc,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by BankAccount.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (b *BankAccount) UnmarshalJSON(data []byte) error {
+	type bankAccount BankAccount
+	extra, err := decodeResource(data, (*bankAccount)(b))
+	b.Extra = extra
+	return err
 }
 
-func (b *BankAccount) validate() error {
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (b BankAccount) MarshalJSON() ([]byte, error) {
+	type bankAccount BankAccount
+	return encodeResource(bankAccount(b), b.Extra)
+}
+
+// Validate checks that the bank account can be registered with
+// Client.CreateBankAccount. The returned error is a *ValidationError if any
+// field is invalid.
+func (b *BankAccount) Validate() error {
+	idRule := validation.Rule(ruleFunc(validateMyKad))
+	if BoolValue(b.Organization) {
+		idRule = ruleFunc(validateSSMRegistration)
+	}
+
 	err := validation.Errors{
 		"name":   validation.Validate(b.Name, validation.Required),
-		"id_no":  validation.Validate(b.IDNumber, validation.Required),
-		"acc_no": validation.Validate(b.AccountNumber, validation.Required),
-		"code":   validation.Validate(b.Code, validation.Required),
+		"id_no":  validation.Validate(b.IDNumber, validation.Required, idRule),
+		"acc_no": validation.Validate(b.AccountNumber, validation.Required, accountNumberRule(b.Code)),
+		"code":   validation.Validate(b.Code, validation.Required, ruleFunc(validateBankCode)),
 	}.Filter()
-	return err
+	return newValidationError(err)
+}
+
+var (
+	// SSM registration numbers are either in the new 12-digit format (year of
+	// registration, entity type and a sequence number), or in the old format of
+	// up to 9 digits followed by a check letter.
+	ssmRegistrationPattern = regexp.MustCompile(`^(?:(?:19|20)\d{2}0[1-6]\d{6}|\d{1,9}-?[A-Z])$`)
+
+	// MyKad numbers are 12 digits, formatted as YYMMDD-PB-NNNN.
+	myKadPattern = regexp.MustCompile(`^(\d{6})-?(\d{2})-?(\d{4})$`)
+
+	accountNumberPattern = regexp.MustCompile(`^\d+$`)
+)
+
+func validateBankCode(value interface{}) error {
+	code, _ := value.(string)
+	if code == "" {
+		return nil
+	}
+	if bank, ok := BankByCode(code); !ok || !bank.Supports(BankCapabilityVerification) {
+		return newRuleError(CodeInvalidValue, "must be a supported bank code")
+	}
+	return nil
+}
+
+// validateMyKad checks that value is a well-formed MyKad number whose first
+// six digits form a valid date of birth.
+func validateMyKad(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	m := myKadPattern.FindStringSubmatch(s)
+	if m == nil {
+		return newRuleError(CodeInvalidFormat, "must be a valid MyKad number")
+	}
+	for _, century := range []string{"19", "20"} {
+		if _, err := time.Parse("20060102", century+m[1]); err == nil {
+			return nil
+		}
+	}
+	return newRuleError(CodeInvalidDate, "must contain a valid date of birth")
+}
+
+func validateSSMRegistration(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" || ssmRegistrationPattern.MatchString(s) {
+		return nil
+	}
+	return newRuleError(CodeInvalidFormat, "must be a valid SSM registration number")
+}
+
+// accountNumberRule returns a rule checking that an account number consists of
+// digits only, and matches the length of account numbers issued by the bank with
+// the given code in the bank registry.
+func accountNumberRule(code string) validation.Rule {
+	return ruleFunc(func(value interface{}) error {
+		s, _ := value.(string)
+		if s == "" {
+			return nil
+		}
+		s = normalizeAccountNumber(s)
+		if !accountNumberPattern.MatchString(s) {
+			return newRuleError(CodeInvalidFormat, "must contain digits only")
+		}
+		bank, ok := BankByCode(code)
+		if !ok || (len(s) >= bank.MinAccountNumberLength && len(s) <= bank.MaxAccountNumberLength) {
+			return nil
+		}
+		if bank.MinAccountNumberLength == bank.MaxAccountNumberLength {
+			return newRuleError(CodeInvalidLength,
+				fmt.Sprintf("must be %d digits long for %s", bank.MinAccountNumberLength, bank.Name))
+		}
+		return newRuleError(CodeInvalidLength, fmt.Sprintf("must be between %d and %d digits long for %s",
+			bank.MinAccountNumberLength, bank.MaxAccountNumberLength, bank.Name))
+	})
+}
+
+// normalizeAccountNumber removes the spaces and dashes that account numbers are
+// often written with.
+func normalizeAccountNumber(accountNumber string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(accountNumber)
 }
 
 // BankAccountCheckResponse represents the structure of the response body obtained with
 // Client.CheckRegistration.
 type BankAccountCheckResponse struct {
 	Name string `json:"name,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by BankAccountCheckResponse.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (r *BankAccountCheckResponse) UnmarshalJSON(data []byte) error {
+	type bankAccountCheckResponse BankAccountCheckResponse
+	extra, err := decodeResource(data, (*bankAccountCheckResponse)(r))
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (r BankAccountCheckResponse) MarshalJSON() ([]byte, error) {
+	type bankAccountCheckResponse BankAccountCheckResponse
+	return encodeResource(bankAccountCheckResponse(r), r.Extra)
 }
 
 // BankAccountList represents the structure of the response body obtained with Client.GetBankAccountIndex.
+// NotFound lists the requested account numbers that were not returned by the API.
 type BankAccountList struct {
 	BankAccounts *[]BankAccount `json:"bank_verification_services,omitempty"`
+	NotFound     []string       `json:"-"`
+
+	// Extra holds the fields returned by the API that are not modelled by BankAccountList.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (l *BankAccountList) UnmarshalJSON(data []byte) error {
+	type bankAccountList BankAccountList
+	extra, err := decodeResource(data, (*bankAccountList)(l))
+	l.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (l BankAccountList) MarshalJSON() ([]byte, error) {
+	type bankAccountList BankAccountList
+	return encodeResource(bankAccountList(l), l.Extra)
+}
+
+// chunkStrings splits s into consecutive chunks of at most size elements. An
+// empty s results in a single empty chunk.
+func chunkStrings(s []string, size int) [][]string {
+	if len(s) == 0 {
+		return [][]string{{}}
+	}
+	chunks := make([][]string, 0, (len(s)+size-1)/size)
+	for size < len(s) {
+		s, chunks = s[size:], append(chunks, s[:size])
+	}
+	return append(chunks, s)
 }
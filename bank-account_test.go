@@ -0,0 +1,170 @@
+package billplz
+
+import (
+	"strings"
+	"testing"
+)
+
+func validBankAccount() BankAccount {
+	return BankAccount{
+		Name:          "Insan Jaya",
+		IDNumber:      "910111-10-1111",
+		AccountNumber: "123456789012",
+		Code:          BankCodeMaybank,
+		Organization:  Bool(false),
+	}
+}
+
+func TestBankAccountValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(b *BankAccount)
+		wantField string
+		wantCode  string
+	}{
+		{"valid", func(b *BankAccount) {}, "", ""},
+
+		{"MyKad without dashes", func(b *BankAccount) { b.IDNumber = "910111101111" }, "", ""},
+		{"MyKad born on a leap day of 2000", func(b *BankAccount) { b.IDNumber = "000229-10-1111" }, "", ""},
+		{"MyKad too short", func(b *BankAccount) { b.IDNumber = "910111-10-111" }, "id_no", CodeInvalidFormat},
+		{"MyKad too long", func(b *BankAccount) { b.IDNumber = "9101111011111" }, "id_no", CodeInvalidFormat},
+		{"MyKad with letters", func(b *BankAccount) { b.IDNumber = "91O111-10-1111" }, "id_no", CodeInvalidFormat},
+		{"MyKad invalid month", func(b *BankAccount) { b.IDNumber = "911311-10-1111" }, "id_no", CodeInvalidDate},
+		{"MyKad invalid leap day", func(b *BankAccount) { b.IDNumber = "010229-10-1111" }, "id_no", CodeInvalidDate},
+		{"MyKad missing", func(b *BankAccount) { b.IDNumber = "" }, "id_no", CodeRequired},
+
+		{"SSM new format", func(b *BankAccount) { b.Organization, b.IDNumber = Bool(true), "201901000005" }, "", ""},
+		{"SSM old format", func(b *BankAccount) { b.Organization, b.IDNumber = Bool(true), "1234567-K" }, "", ""},
+		{"SSM old format without dash", func(b *BankAccount) { b.Organization, b.IDNumber = Bool(true), "123456789K" }, "", ""},
+		{"SSM old format too long", func(b *BankAccount) { b.Organization, b.IDNumber = Bool(true), "1234567890-K" }, "id_no", CodeInvalidFormat},
+		{"SSM new format invalid entity type", func(b *BankAccount) { b.Organization, b.IDNumber = Bool(true), "201907000005" }, "id_no", CodeInvalidFormat},
+		{"SSM new format too short", func(b *BankAccount) { b.Organization, b.IDNumber = Bool(true), "20190100000" }, "id_no", CodeInvalidFormat},
+		{"MyKad for organization", func(b *BankAccount) { b.Organization = Bool(true) }, "id_no", CodeInvalidFormat},
+		{"SSM for individual", func(b *BankAccount) { b.IDNumber = "201901000005" }, "id_no", CodeInvalidDate},
+
+		{"account number with separators", func(b *BankAccount) { b.AccountNumber = "1234-5678 9012" }, "", ""},
+		{"account number with letters", func(b *BankAccount) { b.AccountNumber = "12345678901A" }, "acc_no", CodeInvalidFormat},
+		{"account number one digit short", func(b *BankAccount) { b.AccountNumber = "12345678901" }, "acc_no", CodeInvalidLength},
+		{"account number one digit long", func(b *BankAccount) { b.AccountNumber = "1234567890123" }, "acc_no", CodeInvalidLength},
+		{"range shortest", func(b *BankAccount) { b.Code, b.AccountNumber = BankCodeCIMBBank, "1234567890" }, "", ""},
+		{"range longest", func(b *BankAccount) { b.Code, b.AccountNumber = BankCodeCIMBBank, "12345678901234" }, "", ""},
+		{"range below", func(b *BankAccount) { b.Code, b.AccountNumber = BankCodeCIMBBank, "123456789" }, "acc_no", CodeInvalidLength},
+		{"range above", func(b *BankAccount) { b.Code, b.AccountNumber = BankCodeCIMBBank, "123456789012345" }, "acc_no", CodeInvalidLength},
+		{"account number missing", func(b *BankAccount) { b.AccountNumber = "" }, "acc_no", CodeRequired},
+
+		{"unknown bank", func(b *BankAccount) { b.Code = "XXXXMYKL" }, "code", CodeInvalidValue},
+		{"bank code missing", func(b *BankAccount) { b.Code = "" }, "code", CodeRequired},
+		{"name missing", func(b *BankAccount) { b.Name = "" }, "name", CodeRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := validBankAccount()
+			tt.modify(&b)
+			err := b.Validate()
+
+			if tt.wantField == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			if len(verr.Fields) != 1 {
+				t.Errorf("Validate() = %v, want a single failure", err)
+			}
+			f := verr.Field(tt.wantField)
+			if f == nil || f.Code != tt.wantCode {
+				t.Errorf("Validate() = %v, want %s to fail with %s", err, tt.wantField, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestBankAccountValidateLengthMessage(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{BankCodeMaybank, "must be 12 digits long for Maybank"},
+		{BankCodeCIMBBank, "must be between 10 and 14 digits long for CIMB Bank"},
+	}
+
+	for _, tt := range tests {
+		b := validBankAccount()
+		b.Code, b.AccountNumber = tt.code, "123"
+		verr, ok := b.Validate().(*ValidationError)
+		if !ok || verr.Field("acc_no") == nil || !strings.Contains(verr.Field("acc_no").Message, tt.want) {
+			t.Errorf("Validate() for %s = %v, want %q", tt.code, verr, tt.want)
+		}
+	}
+}
+
+func TestBankRegistry(t *testing.T) {
+	all := Banks()
+	if len(all) != len(banks) {
+		t.Fatalf("Banks() returned %d banks, want %d", len(all), len(banks))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Name >= all[i].Name {
+			t.Errorf("Banks() is not sorted by name: %q before %q", all[i-1].Name, all[i].Name)
+		}
+	}
+	all[0].Name = "Modified"
+	if Banks()[0].Name == "Modified" {
+		t.Error("Banks() returned the registry itself")
+	}
+
+	for _, b := range Banks() {
+		if got, ok := BankByCode(b.Code); !ok || got != b {
+			t.Errorf("BankByCode(%q) = %+v, %v", b.Code, got, ok)
+		}
+		if b.Supports(BankCapabilityFPX) != (b.FPXCode != "") {
+			t.Errorf("%s supports FPX = %v with FPX code %q", b.Name, b.Supports(BankCapabilityFPX), b.FPXCode)
+		}
+		if b.MinAccountNumberLength <= 0 || b.MinAccountNumberLength > b.MaxAccountNumberLength {
+			t.Errorf("%s has account number lengths %d to %d", b.Name, b.MinAccountNumberLength, b.MaxAccountNumberLength)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		lookup func() (Bank, bool)
+		want   string
+		wantOK bool
+	}{
+		{"by code", func() (Bank, bool) { return BankByCode(BankCodeMaybank) }, "Maybank", true},
+		{"by unknown code", func() (Bank, bool) { return BankByCode("XXXXMYKL") }, "", false},
+		{"by empty code", func() (Bank, bool) { return BankByCode("") }, "", false},
+		{"by name", func() (Bank, bool) { return BankByName("CIMB Bank") }, "CIMB Bank", true},
+		{"by name in other case", func() (Bank, bool) { return BankByName("public BANK") }, "Public Bank", true},
+		{"by unknown name", func() (Bank, bool) { return BankByName("Bank of Nowhere") }, "", false},
+	}
+	for _, tt := range tests {
+		b, ok := tt.lookup()
+		if ok != tt.wantOK || b.Name != tt.want {
+			t.Errorf("lookup %s = %q, %v, want %q, %v", tt.name, b.Name, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestBanksSupporting(t *testing.T) {
+	fpx := BanksSupporting(BankCapabilityFPX)
+	for _, b := range fpx {
+		if b.Code == BankCodeCitibank || b.Code == BankCodeAlRajhiBank {
+			t.Errorf("BanksSupporting(FPX) includes %s, which has no FPX code", b.Name)
+		}
+	}
+	if len(fpx) != len(banks)-2 {
+		t.Errorf("BanksSupporting(FPX) returned %d banks, want %d", len(fpx), len(banks)-2)
+	}
+	if n := len(BanksSupporting(BankCapabilityFPX | BankCapabilityVerification)); n != len(fpx) {
+		t.Errorf("BanksSupporting(FPX|Verification) returned %d banks, want %d", n, len(fpx))
+	}
+	if n := len(BanksSupporting(BankCapabilityVerification)); n != len(banks) {
+		t.Errorf("BanksSupporting(Verification) returned %d banks, want %d", n, len(banks))
+	}
+}
@@ -0,0 +1,115 @@
+package billplz
+
+import (
+	"sort"
+	"strings"
+)
+
+// BankCapability represents a service that a bank supports through the Billplz API.
+type BankCapability uint
+
+// Capabilities of banks supported by the Billplz API.
+const (
+	// BankCapabilityFPX is set for banks that accept payments through FPX.
+	BankCapabilityFPX BankCapability = 1 << iota
+
+	// BankCapabilityVerification is set for banks whose accounts can be registered
+	// through the Bank Account Direct Verification Service.
+	BankCapabilityVerification
+)
+
+// Bank represents a bank supported by the Billplz API.
+type Bank struct {
+	// Name is the display name of the bank.
+	Name string
+
+	// Code is the bank's SWIFT code, as used in BankAccount.Code.
+	Code string
+
+	// FPXCode is the bank's FPX code. It is empty for banks that do not support FPX.
+	FPXCode string
+
+	// Capabilities is the set of services supported by the bank.
+	Capabilities BankCapability
+
+	// MinAccountNumberLength and MaxAccountNumberLength are the bounds on the
+	// number of digits in account numbers issued by the bank.
+	MinAccountNumberLength int
+	MaxAccountNumberLength int
+}
+
+// Supports reports whether the bank supports the given capability.
+func (b Bank) Supports(c BankCapability) bool {
+	return b.Capabilities&c == c
+}
+
+var banks = []Bank{
+	{"Affin Bank", BankCodeAffinBank, "ABB0233", BankCapabilityFPX | BankCapabilityVerification, 12, 12},
+	{"Agrobank", BankCodeAgrobank, "AGRO01", BankCapabilityFPX | BankCapabilityVerification, 16, 16},
+	{"Alliance Bank", BankCodeAllianceBank, "ABMB0212", BankCapabilityFPX | BankCapabilityVerification, 15, 15},
+	{"Al-Rajhi Bank", BankCodeAlRajhiBank, "", BankCapabilityVerification, 15, 15},
+	{"AmBank", BankCodeAmBank, "AMBB0209", BankCapabilityFPX | BankCapabilityVerification, 13, 13},
+	{"Bank Islam", BankCodeBankIslam, "BIMB0340", BankCapabilityFPX | BankCapabilityVerification, 14, 14},
+	{"Bank Kerjasama Rakyat", BankCodeBankKerjasamaRakyat, "BKRM0602", BankCapabilityFPX | BankCapabilityVerification, 12, 12},
+	{"Bank Muamalat", BankCodeBankMuamalat, "BMMB0341", BankCapabilityFPX | BankCapabilityVerification, 14, 14},
+	{"Bank Simpanan Nasional", BankCodeBankSimpananNasional, "BSN0601", BankCapabilityFPX | BankCapabilityVerification, 16, 16},
+	{"CIMB Bank", BankCodeCIMBBank, "BCBB0235", BankCapabilityFPX | BankCapabilityVerification, 10, 14},
+	{"Citibank", BankCodeCitibank, "", BankCapabilityVerification, 10, 10},
+	{"Hong Leong Bank", BankCodeHongLeongBank, "HLB0224", BankCapabilityFPX | BankCapabilityVerification, 11, 12},
+	{"HSBC Bank", BankCodeHSBCBank, "HSBC0223", BankCapabilityFPX | BankCapabilityVerification, 12, 12},
+	{"Maybank", BankCodeMaybank, "MB2U0227", BankCapabilityFPX | BankCapabilityVerification, 12, 12},
+	{"OCBC Bank", BankCodeOCBCBank, "OCBC0229", BankCapabilityFPX | BankCapabilityVerification, 10, 12},
+	{"Public Bank", BankCodePublicBank, "PBB0233", BankCapabilityFPX | BankCapabilityVerification, 10, 10},
+	{"RHB Bank", BankCodeRHBBank, "RHB0218", BankCapabilityFPX | BankCapabilityVerification, 14, 14},
+	{"Standard Chartered Bank", BankCodeStandardCharteredBank, "SCB0216", BankCapabilityFPX | BankCapabilityVerification, 11, 11},
+	{"United Overseas Bank", BankCodeUnitedOverseasBank, "UOB0226", BankCapabilityFPX | BankCapabilityVerification, 10, 10},
+}
+
+var banksByCode = func() map[string]Bank {
+	m := make(map[string]Bank, len(banks))
+	for _, b := range banks {
+		m[b.Code] = b
+	}
+	return m
+}()
+
+// Banks returns all banks supported by the Billplz API, sorted by name.
+// The returned slice is a copy and can be modified freely.
+func Banks() []Bank {
+	result := make([]Bank, len(banks))
+	copy(result, banks)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// BanksSupporting returns the banks that support the given capability, sorted by name.
+func BanksSupporting(c BankCapability) []Bank {
+	result := []Bank{}
+	for _, b := range Banks() {
+		if b.Supports(c) {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+// BankByCode returns the bank with the given SWIFT code. The boolean result
+// is false if no supported bank has the code.
+func BankByCode(code string) (Bank, bool) {
+	b, ok := banksByCode[code]
+	return b, ok
+}
+
+// BankByName returns the bank with the given display name, compared
+// case-insensitively. The boolean result is false if no supported bank has
+// the name.
+func BankByName(name string) (Bank, bool) {
+	for _, b := range banks {
+		if strings.EqualFold(b.Name, name) {
+			return b, true
+		}
+	}
+	return Bank{}, false
+}
@@ -0,0 +1,117 @@
+package billplz
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// GetBillsOptions configures how bills are fetched by Client.GetBills and
+// Client.StreamBills.
+type GetBillsOptions struct {
+	// Concurrency is the maximum number of bills fetched at the same time.
+	// Defaults to the client's Concurrency if not positive.
+	Concurrency int
+
+	// RateLimit is the minimum time between two requests, shared across all
+	// fetched bills. Requests are only limited by the client's RateLimiter if
+	// RateLimit is not positive.
+	RateLimit time.Duration
+}
+
+// BillResult is the result of fetching a bill with Client.GetBills or
+// Client.StreamBills.
+type BillResult struct {
+	// BillID is the ID of the fetched bill.
+	BillID string
+
+	// Bill is the bill returned by the API. It is nil if the fetch failed.
+	Bill *Bill
+
+	// Err is set if the fetch failed. It is ErrBillNotFound if the bill does
+	// not exist.
+	Err error
+}
+
+// GetBills fetches the bills with the given IDs concurrently, and returns their
+// results keyed by bill ID. A bill that could not be fetched has its error set
+// in its result, so a single failure does not fail the whole set.
+// An error will be returned if ctx is done before every bill is fetched, in
+// which case the returned map holds the results received so far.
+func (c *Client) GetBills(ctx context.Context, ids []string, opts GetBillsOptions) (map[string]BillResult, error) {
+	results := make(map[string]BillResult, len(ids))
+	for result := range c.StreamBills(ctx, ids, opts) {
+		results[result.BillID] = result
+	}
+	for _, id := range ids {
+		if _, ok := results[id]; !ok {
+			return results, ctx.Err()
+		}
+	}
+	return results, nil
+}
+
+// StreamBills fetches the bills with the given IDs concurrently, and sends the
+// result of each bill on the returned channel as soon as it is fetched, in no
+// particular order. Duplicate IDs are fetched once. Unlike GetBills, the
+// fetched bills do not have to be held in memory together, though the IDs do.
+// The channel is closed once every bill has been fetched, or when ctx is done.
+func (c *Client) StreamBills(ctx context.Context, ids []string, opts GetBillsOptions) <-chan BillResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = c.concurrency()
+	}
+	var limiter RateLimiter
+	if opts.RateLimit > 0 {
+		limiter = newRateLimiter(opts.RateLimit)
+	}
+
+	queue := make(chan string)
+	results := make(chan BillResult, concurrency)
+
+	go func() {
+		defer close(queue)
+		seen := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			select {
+			case queue <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				if limiter != nil {
+					if err := limiter.Wait(ctx); err != nil {
+						return
+					}
+				}
+				b, err := c.getBill(ctx, id)
+				if ctx.Err() != nil {
+					return
+				}
+				select {
+				case results <- BillResult{BillID: id, Bill: b, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
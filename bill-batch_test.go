@@ -0,0 +1,141 @@
+package billplz
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// billServer serves bills whose ID does not start with "missing", counting
+// requests per ID and the largest number of requests in flight.
+type billServer struct {
+	delay time.Duration
+
+	mu          sync.Mutex
+	requests    map[string]int
+	inFlight    int
+	maxInFlight int
+	times       []time.Time
+}
+
+func (s *billServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/v3/bills/")
+	s.mu.Lock()
+	if s.requests == nil {
+		s.requests = make(map[string]int)
+	}
+	s.requests[id]++
+	s.times = append(s.times, time.Now())
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+
+	if strings.HasPrefix(id, "missing") {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte(`{"id":"` + id + `","collection_id":"inbmmepb","amount":200}`))
+}
+
+func TestGetBills(t *testing.T) {
+	s := &billServer{delay: 10 * time.Millisecond}
+	c := newTestClient(t, s)
+	ids := []string{"8X0Iyzaw", "missing1", "8X0Iyzaw", "8X0Iyzax", "8X0Iyzay", "8X0Iyzaz", "missing1"}
+
+	results, err := c.GetBills(context.Background(), ids, GetBillsOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("GetBills() error = %v", err)
+	}
+	if len(results) != 5 {
+		t.Errorf("got %d results, want 5", len(results))
+	}
+	for _, id := range ids {
+		r := results[id]
+		if r.BillID != id {
+			t.Errorf("result for %s has BillID %q", id, r.BillID)
+		}
+		if strings.HasPrefix(id, "missing") {
+			if r.Err != ErrBillNotFound || r.Bill != nil {
+				t.Errorf("result for %s = %v, %v, want ErrBillNotFound", id, r.Bill, r.Err)
+			}
+		} else if r.Err != nil || r.Bill == nil || r.Bill.ID != id {
+			t.Errorf("result for %s = %+v, %v", id, r.Bill, r.Err)
+		}
+	}
+	for id, n := range s.requests {
+		if n != 1 {
+			t.Errorf("%s fetched %d times, want once", id, n)
+		}
+	}
+	if s.maxInFlight > 2 {
+		t.Errorf("%d requests in flight, want at most 2", s.maxInFlight)
+	}
+}
+
+func TestGetBillsRateLimit(t *testing.T) {
+	s := &billServer{}
+	c := newTestClient(t, s)
+	const rate = 20 * time.Millisecond
+
+	_, err := c.GetBills(context.Background(), []string{"a", "b", "c", "d"}, GetBillsOptions{Concurrency: 4, RateLimit: rate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(s.times); i++ {
+		// Allow for the time between the limiter and the server.
+		if gap := s.times[i].Sub(s.times[i-1]); gap < rate/2 {
+			t.Errorf("requests %d and %d were %v apart, want about %v", i-1, i, gap, rate)
+		}
+	}
+}
+
+func TestGetBillsCanceled(t *testing.T) {
+	var served int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&served, 1) == 3 {
+			cancel()
+		}
+		w.Write([]byte(`{"id":"` + strings.TrimPrefix(r.URL.Path, "/v3/bills/") + `"}`))
+	}))
+
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	results, err := c.GetBills(ctx, ids, GetBillsOptions{Concurrency: 1})
+	if err != context.Canceled {
+		t.Errorf("GetBills() error = %v, want context.Canceled", err)
+	}
+	if len(results) == 0 || len(results) >= len(ids) {
+		t.Errorf("got %d results, want a partial set", len(results))
+	}
+	for id, r := range results {
+		if r.Err != nil || r.Bill == nil || r.Bill.ID != id {
+			t.Errorf("result for %s = %+v, %v", id, r.Bill, r.Err)
+		}
+	}
+}
+
+func TestStreamBills(t *testing.T) {
+	s := &billServer{}
+	c := newTestClient(t, s)
+
+	seen := make(map[string]int)
+	for result := range c.StreamBills(context.Background(), []string{"a", "b", "a", "missing"}, GetBillsOptions{Concurrency: 3}) {
+		seen[result.BillID]++
+	}
+	if len(seen) != 3 || seen["a"] != 1 || seen["b"] != 1 || seen["missing"] != 1 {
+		t.Errorf("streamed %v, want each ID once", seen)
+	}
+}
@@ -0,0 +1,230 @@
+package billplz
+
+import (
+	"container/heap"
+	"context"
+	"time"
+)
+
+// Default values used by PollOptions.
+const (
+	defaultPollInterval    = 5 * time.Second
+	defaultPollMaxInterval = time.Minute
+	defaultPollMultiplier  = 1.5
+	defaultPollRateLimit   = 200 * time.Millisecond
+)
+
+// PollOptions configures how bills are polled by Client.WaitForBillPaid and
+// Client.WatchBills. Zero values are replaced with defaults.
+type PollOptions struct {
+	// Interval is the delay between polls of a bill after its state changes.
+	// Defaults to 5 seconds.
+	Interval time.Duration
+
+	// MaxInterval caps the delay between polls of a bill whose state has
+	// not changed. Defaults to 1 minute.
+	MaxInterval time.Duration
+
+	// Multiplier is applied to a bill's polling delay every time it is polled
+	// without a change in state, or the poll fails. Defaults to 1.5.
+	Multiplier float64
+
+	// RateLimit is the minimum time between two requests, shared across all
+	// watched bills. Defaults to 200 milliseconds.
+	RateLimit time.Duration
+}
+
+func (o PollOptions) withDefaults() PollOptions {
+	if o.Interval <= 0 {
+		o.Interval = defaultPollInterval
+	}
+	if o.MaxInterval <= 0 {
+		o.MaxInterval = defaultPollMaxInterval
+	}
+	if o.MaxInterval < o.Interval {
+		o.MaxInterval = o.Interval
+	}
+	if o.Multiplier < 1 {
+		o.Multiplier = defaultPollMultiplier
+	}
+	if o.RateLimit <= 0 {
+		o.RateLimit = defaultPollRateLimit
+	}
+	return o
+}
+
+// BillEvent represents a change observed while watching a bill with
+// Client.WatchBills.
+type BillEvent struct {
+	// BillID is the ID of the watched bill.
+	BillID string
+
+	// Bill is the latest state of the bill. It is nil if the poll failed or
+	// the bill no longer exists.
+	Bill *Bill
+
+	// Err is set if the poll failed. Polling continues after a failed poll
+	// unless the error is ErrBillNotFound.
+	Err error
+
+	// Terminal is true if the bill has been paid or deleted, and will not be
+	// polled again.
+	Terminal bool
+}
+
+// WaitForBillPaid polls a bill with the given ID until it is paid, and returns
+// the paid bill.
+// ErrBillDeleted is returned if the bill is deleted before being paid, and
+// ErrBillNotFound is returned if the bill does not exist. Failed polls are
+// retried until ctx is done, in which case the context's error is returned.
+func (c *Client) WaitForBillPaid(ctx context.Context, id string, opts PollOptions) (*Bill, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for event := range c.WatchBills(ctx, []string{id}, opts) {
+		if !event.Terminal {
+			continue
+		}
+		if event.Err != nil {
+			return nil, event.Err
+		}
+		if !isBillPaid(event.Bill) {
+			return event.Bill, ErrBillDeleted
+		}
+		return event.Bill, nil
+	}
+	return nil, ctx.Err()
+}
+
+// WatchBills polls a set of bills with the given IDs and sends an event on the
+// returned channel whenever the state of a bill changes or a poll fails.
+// Bills are polled with backoff, and are no longer polled once they reach a
+// terminal state (paid or deleted). All bills share a single rate limit.
+// The channel is closed once every bill has reached a terminal state, or when
+// ctx is done.
+func (c *Client) WatchBills(ctx context.Context, ids []string, opts PollOptions) <-chan BillEvent {
+	opts = opts.withDefaults()
+	events := make(chan BillEvent, len(ids))
+
+	queue := make(billPollQueue, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	now := time.Now()
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		queue = append(queue, &billPoll{id: id, next: now, interval: opts.Interval})
+	}
+	heap.Init(&queue)
+
+	go func() {
+		defer close(events)
+		c.watchBills(ctx, &queue, opts, events)
+	}()
+	return events
+}
+
+func (c *Client) watchBills(ctx context.Context, queue *billPollQueue, opts PollOptions, events chan<- BillEvent) {
+	limiter := newRateLimiter(opts.RateLimit)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for queue.Len() > 0 {
+		p := (*queue)[0]
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(p.next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return
+		}
+		b, err := c.getBill(ctx, p.id)
+		if ctx.Err() != nil {
+			return
+		}
+
+		event := BillEvent{BillID: p.id, Bill: b, Err: err}
+		changed := false
+		switch {
+		case err == ErrBillNotFound:
+			event.Terminal = true
+		case err != nil:
+		default:
+			state := billPollState(b)
+			changed = !p.polled || state != p.state
+			p.state = state
+			event.Terminal = isBillPaid(b) || b.State == "deleted"
+		}
+		p.polled = true
+
+		if changed || err != nil || event.Terminal {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if event.Terminal {
+			heap.Pop(queue)
+			continue
+		}
+		if changed {
+			p.interval = opts.Interval
+		} else {
+			p.interval = time.Duration(float64(p.interval) * opts.Multiplier)
+			if p.interval > opts.MaxInterval {
+				p.interval = opts.MaxInterval
+			}
+		}
+		p.next = time.Now().Add(p.interval)
+		heap.Fix(queue, 0)
+	}
+}
+
+func isBillPaid(b *Bill) bool {
+	return b != nil && (BoolValue(b.Paid) || b.State == "paid")
+}
+
+func billPollState(b *Bill) string {
+	if BoolValue(b.Paid) {
+		return b.State + ":paid"
+	}
+	return b.State
+}
+
+// billPoll tracks the polling schedule of a single watched bill.
+type billPoll struct {
+	id       string
+	next     time.Time
+	interval time.Duration
+	state    string
+	polled   bool
+}
+
+// billPollQueue is a min-heap of watched bills ordered by their next poll time.
+type billPollQueue []*billPoll
+
+func (q billPollQueue) Len() int            { return len(q) }
+func (q billPollQueue) Less(i, j int) bool  { return q[i].next.Before(q[j].next) }
+func (q billPollQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *billPollQueue) Push(x interface{}) { *q = append(*q, x.(*billPoll)) }
+
+func (q *billPollQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	p := old[n-1]
+	*q = old[:n-1]
+	return p
+}
@@ -0,0 +1,200 @@
+package billplz
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// billStates serves each bill's scripted responses in turn, repeating the last
+// one, and records when each bill is requested. A "404" response means the bill
+// does not exist, and "500" fails the request.
+type billStates struct {
+	mu       sync.Mutex
+	script   map[string][]string
+	requests map[string][]time.Time
+	all      []time.Time
+}
+
+func newBillStates(script map[string][]string) *billStates {
+	return &billStates{script: script, requests: make(map[string][]time.Time)}
+}
+
+func (s *billStates) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/v3/bills/")
+	s.mu.Lock()
+	now := time.Now()
+	s.all = append(s.all, now)
+	s.requests[id] = append(s.requests[id], now)
+	responses := s.script[id]
+	state := responses[len(responses)-1]
+	if n := len(s.requests[id]); n <= len(responses) {
+		state = responses[n-1]
+	}
+	s.mu.Unlock()
+
+	switch state {
+	case "404":
+		http.NotFound(w, r)
+	case "500":
+		http.Error(w, `{"error":{"type":"Internal","message":["failed"]}}`, http.StatusInternalServerError)
+	default:
+		w.Write([]byte(`{"id":"` + id + `","state":"` + state + `","paid":` + boolString(state == "paid") + `}`))
+	}
+}
+
+func (s *billStates) count(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests[id])
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+var fastPoll = PollOptions{
+	Interval:    5 * time.Millisecond,
+	MaxInterval: 20 * time.Millisecond,
+	Multiplier:  2,
+	RateLimit:   time.Millisecond,
+}
+
+func TestWaitForBillPaid(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		wantErr   error
+		wantState string
+		wantPolls int
+	}{
+		{"paid", []string{"due", "due", "500", "paid"}, nil, "paid", 4},
+		{"deleted", []string{"due", "deleted"}, ErrBillDeleted, "deleted", 2},
+		{"not found", []string{"404"}, ErrBillNotFound, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newBillStates(map[string][]string{"8X0Iyzaw": tt.responses})
+			c := newTestClient(t, s)
+
+			b, err := c.WaitForBillPaid(context.Background(), "8X0Iyzaw", fastPoll)
+			if err != tt.wantErr {
+				t.Fatalf("WaitForBillPaid() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantState == "" {
+				if b != nil {
+					t.Errorf("WaitForBillPaid() = %+v, want nil", b)
+				}
+			} else if b == nil || b.State != tt.wantState {
+				t.Errorf("WaitForBillPaid() = %+v, want state %s", b, tt.wantState)
+			}
+			if n := s.count("8X0Iyzaw"); n != tt.wantPolls {
+				t.Errorf("polled %d times, want %d", n, tt.wantPolls)
+			}
+		})
+	}
+}
+
+func TestWaitForBillPaidCanceled(t *testing.T) {
+	s := newBillStates(map[string][]string{"8X0Iyzaw": {"due"}})
+	c := newTestClient(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.WaitForBillPaid(ctx, "8X0Iyzaw", fastPoll); err != context.DeadlineExceeded {
+		t.Errorf("WaitForBillPaid() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWatchBills(t *testing.T) {
+	s := newBillStates(map[string][]string{
+		"a": {"due", "due", "due", "paid"},
+		"b": {"due", "500", "deleted"},
+		"c": {"404"},
+	})
+	c := newTestClient(t, s)
+
+	var events []BillEvent
+	for event := range c.WatchBills(context.Background(), []string{"a", "b", "c", "a"}, fastPoll) {
+		events = append(events, event)
+	}
+
+	got := make(map[string][]string)
+	for _, event := range events {
+		var kind string
+		switch {
+		case event.Err == ErrBillNotFound:
+			kind = "not found"
+		case event.Err != nil:
+			kind = "error"
+		default:
+			kind = event.Bill.State
+		}
+		if event.Terminal {
+			kind += " (terminal)"
+		}
+		got[event.BillID] = append(got[event.BillID], kind)
+	}
+	want := map[string][]string{
+		"a": {"due", "paid (terminal)"},
+		"b": {"due", "error", "deleted (terminal)"},
+		"c": {"not found (terminal)"},
+	}
+	for id, kinds := range want {
+		if strings.Join(got[id], ", ") != strings.Join(kinds, ", ") {
+			t.Errorf("events for %s = %v, want %v", id, got[id], kinds)
+		}
+	}
+	if n := s.count("a"); n != 4 {
+		t.Errorf("a polled %d times, want 4 despite being watched twice", n)
+	}
+	if n := s.count("c"); n != 1 {
+		t.Errorf("c polled %d times after being reported as not found", n)
+	}
+}
+
+func TestWatchBillsSchedule(t *testing.T) {
+	s := newBillStates(map[string][]string{"a": {"due"}, "b": {"due"}})
+	c := newTestClient(t, s)
+	opts := PollOptions{
+		Interval:    10 * time.Millisecond,
+		MaxInterval: 40 * time.Millisecond,
+		Multiplier:  2,
+		RateLimit:   5 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	for range c.WatchBills(ctx, []string{"a", "b"}, opts) {
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 1; i < len(s.all); i++ {
+		// Allow for the time between the limiter and the server.
+		if gap := s.all[i].Sub(s.all[i-1]); gap < opts.RateLimit/2 {
+			t.Errorf("requests %d and %d were %v apart, want at least %v", i-1, i, gap, opts.RateLimit)
+		}
+	}
+
+	times := s.requests["a"]
+	if len(times) < 5 {
+		t.Fatalf("a polled %d times, want at least 5", len(times))
+	}
+	// The delay doubles from Interval while the state is unchanged, up to
+	// MaxInterval.
+	want := []time.Duration{10, 20, 40, 40}
+	for i, d := range want {
+		gap := times[i+1].Sub(times[i])
+		if d *= time.Millisecond; gap < d || gap > d+opts.RateLimit+30*time.Millisecond {
+			t.Errorf("poll %d came %v after the previous one, want about %v", i+1, gap, d)
+		}
+	}
+}
@@ -1,17 +1,37 @@
 package billplz
 
 import (
+	"encoding/json"
+	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 )
 
+// billDueDateLayout is the layout of Bill.DueAt. Billplz accepts dates with or
+// without zero-padding, such as 2018-04-19 and 2018-4-19.
+const billDueDateLayout = "2006-1-2"
+
+// minBillAmount is the smallest bill amount accepted by Billplz, in cents.
+const minBillAmount = 100
+
+var (
+	// Malaysian mobile numbers in E.164 form: +60, followed by 1, a one or
+	// two digit operator prefix and a 7 or 8 digit subscriber number.
+	mobilePattern = regexp.MustCompile(`^\+601\d{8,9}$`)
+
+	mobileSeparators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+)
+
 // Bill represents a bill contained within a collection.
+// Optional boolean fields are pointers, so that false can be sent explicitly, and
+// fields missing from a response are nil. Use Bool to set them.
 type Bill struct {
 	ID              string `json:"id,omitempty"`
 	CollectionID    string `json:"collection_id,omitempty"`
-	Paid            bool   `json:"paid,omitempty"`
+	Paid            *bool  `json:"paid,omitempty"`
 	State           string `json:"state,omitempty"`
 	Amount          uint   `json:"amount,omitempty"`
 	PaidAmount      uint   `json:"paid_amount,omitempty"`
@@ -24,27 +44,92 @@ type Bill struct {
 	Reference1      string `json:"reference_1,omitempty"`
 	Reference2Label string `json:"reference_2_label,omitempty"`
 	Reference2      string `json:"reference_2,omitempty"`
-	Deliver         bool   `json:"deliver,omitempty"`
+	Deliver         *bool  `json:"deliver,omitempty"`
 	RedirectURL     string `json:"redirect_url,omitempty"`
 	CallbackURL     string `json:"callback_url,omitempty"`
 	Description     string `json:"description,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by Bill.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (b *Bill) UnmarshalJSON(data []byte) error {
+	type bill Bill
+	extra, err := decodeResource(data, (*bill)(b))
+	b.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (b Bill) MarshalJSON() ([]byte, error) {
+	type bill Bill
+	return encodeResource(bill(b), b.Extra)
 }
 
-func (b *Bill) validate() error {
-	err := validation.Errors{
+// Validate checks that the bill can be created with Client.CreateBill. The
+// returned error is a *ValidationError if any field is invalid.
+func (b *Bill) Validate() error {
+	errs := validation.Errors{
 		"collection_id":     validation.Validate(b.CollectionID, validation.Required),
 		"email":             validation.Validate(b.Email, is.Email),
-		"mobile":            validation.Validate(b.Mobile, validation.Match(regexp.MustCompile(`\+?60\d{8,10}`))),
+		"mobile":            validation.Validate(b.Mobile, ruleFunc(validateMobile)),
 		"name":              validation.Validate(b.Name, validation.Required),
-		"amount":            validation.Validate(b.Amount, validation.Required),
+		"amount":            validation.Validate(b.Amount, validation.Required, ruleFunc(validateBillAmount)),
 		"callback_url":      validation.Validate(b.CallbackURL, validation.Required, is.URL),
 		"description":       validation.Validate(b.Description, validation.Required, validation.Length(1, 200)),
-		"due_at":            validation.Validate(b.DueAt, validation.Date("2018-04-19")),
+		"due_at":            validation.Validate(b.DueAt, validation.Date(billDueDateLayout)),
 		"redirect_url":      validation.Validate(b.RedirectURL, is.URL),
 		"reference_1_label": validation.Validate(b.Reference1Label, validation.Length(0, 20)),
 		"reference_1":       validation.Validate(b.Reference1, validation.Length(0, 120)),
 		"reference_2_label": validation.Validate(b.Reference2Label, validation.Length(0, 20)),
 		"reference_2":       validation.Validate(b.Reference2, validation.Length(0, 120)),
-	}.Filter()
-	return err
+	}
+	if b.Email == "" && b.Mobile == "" {
+		errs["email"] = newRuleError(CodeRequired, "cannot be blank if mobile is blank")
+		errs["mobile"] = newRuleError(CodeRequired, "cannot be blank if email is blank")
+	}
+	return newValidationError(errs.Filter())
+}
+
+// normalize rewrites the bill's fields into the form expected by the API. It
+// should only be called on a bill that passed validation.
+func (b *Bill) normalize() {
+	if mobile, ok := normalizeMobile(b.Mobile); ok {
+		b.Mobile = mobile
+	}
+}
+
+// normalizeMobile converts a Malaysian mobile number written in local or
+// international form, such as 012-345 6789 or 60123456789, into E.164 form.
+// The boolean result is false if the number is not a Malaysian mobile number.
+func normalizeMobile(mobile string) (string, bool) {
+	s := mobileSeparators.Replace(mobile)
+	switch {
+	case strings.HasPrefix(s, "+60"):
+	case strings.HasPrefix(s, "60"):
+		s = "+" + s
+	case strings.HasPrefix(s, "0"):
+		s = "+6" + s
+	}
+	return s, mobilePattern.MatchString(s)
+}
+
+func validateMobile(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	if _, ok := normalizeMobile(s); !ok {
+		return newRuleError(CodeInvalidFormat, "must be a valid Malaysian mobile number")
+	}
+	return nil
+}
+
+func validateBillAmount(value interface{}) error {
+	amount, _ := value.(uint)
+	if amount != 0 && amount < minBillAmount {
+		return newRuleError(CodeOutOfRange, fmt.Sprintf("must be at least %d cents", minBillAmount))
+	}
+	return nil
 }
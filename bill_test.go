@@ -0,0 +1,88 @@
+package billplz
+
+import "testing"
+
+func validBill() Bill {
+	return Bill{
+		CollectionID: "inbmmepb",
+		Email:        "api@billplz.com",
+		Name:         "Michael Yap",
+		Amount:       200,
+		CallbackURL:  "http://example.com/webhook/",
+		Description:  "Maecenas eu placerat ante.",
+	}
+}
+
+func TestBillValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(b *Bill)
+		field  string // field expected to fail, or empty if the bill is valid
+		code   string
+	}{
+		{"valid", func(b *Bill) {}, "", ""},
+		{"due_at padded", func(b *Bill) { b.DueAt = "2018-04-19" }, "", ""},
+		{"due_at unpadded", func(b *Bill) { b.DueAt = "2018-4-9" }, "", ""},
+		{"due_at invalid month", func(b *Bill) { b.DueAt = "2018-13-19" }, "due_at", CodeInvalidDate},
+		{"due_at wrong layout", func(b *Bill) { b.DueAt = "19/04/2018" }, "due_at", CodeInvalidDate},
+		{"mobile local", func(b *Bill) { b.Mobile = "012-345 6789" }, "", ""},
+		{"mobile international", func(b *Bill) { b.Mobile = "+60123456789" }, "", ""},
+		{"mobile without plus", func(b *Bill) { b.Mobile = "601123456789" }, "", ""},
+		{"mobile surrounded", func(b *Bill) { b.Mobile = "abc60123456789xyz" }, "mobile", CodeInvalidFormat},
+		{"mobile landline", func(b *Bill) { b.Mobile = "03-2345 6789" }, "mobile", CodeInvalidFormat},
+		{"mobile too short", func(b *Bill) { b.Mobile = "012345" }, "mobile", CodeInvalidFormat},
+		{"mobile only", func(b *Bill) { b.Email = ""; b.Mobile = "0123456789" }, "", ""},
+		{"neither email nor mobile", func(b *Bill) { b.Email = "" }, "email", CodeRequired},
+		{"neither mobile nor email", func(b *Bill) { b.Email = "" }, "mobile", CodeRequired},
+		{"amount minimum", func(b *Bill) { b.Amount = minBillAmount }, "", ""},
+		{"amount below minimum", func(b *Bill) { b.Amount = minBillAmount - 1 }, "amount", CodeOutOfRange},
+		{"amount missing", func(b *Bill) { b.Amount = 0 }, "amount", CodeRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := validBill()
+			tt.modify(&b)
+			err := b.Validate()
+
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			f := verr.Field(tt.field)
+			if f == nil {
+				t.Fatalf("Validate() = %v, want a failure of %s", err, tt.field)
+			}
+			if f.Code != tt.code {
+				t.Errorf("%s failed with code %q, want %q", tt.field, f.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestBillNormalize(t *testing.T) {
+	tests := []struct {
+		mobile string
+		want   string
+	}{
+		{"012-345 6789", "+60123456789"},
+		{"(012) 3456789", "+60123456789"},
+		{"0111-234 5678", "+601112345678"},
+		{"60123456789", "+60123456789"},
+		{"+60123456789", "+60123456789"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		b := Bill{Mobile: tt.mobile}
+		b.normalize()
+		if b.Mobile != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.mobile, b.Mobile, tt.want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// Package billplztest provides utilities for testing code that uses the billplz package.
+package billplztest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// Mode determines whether a Recorder records live interactions or replays
+// recorded ones.
+type Mode int
+
+// Modes supported by Recorder.
+const (
+	// ModeReplay serves responses from the cassette without making requests.
+	ModeReplay Mode = iota
+
+	// ModeRecord forwards every request to the underlying transport, and
+	// records the interaction in the cassette.
+	ModeRecord
+)
+
+// Cassette represents the set of interactions recorded by a Recorder.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction represents a recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest represents a request made by a billplz.Client. The host and
+// headers of the request are not recorded, so cassettes never contain the API
+// key, and cassettes recorded against the sandbox can be replayed by a client
+// configured for production.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse represents a response received from the Billplz API.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Recorder is an http.RoundTripper that records interactions with the Billplz
+// API into a cassette file, and replays them in later runs.
+// Use it as the transport of the http.Client given to billplz.NewClient.
+type Recorder struct {
+	// Mode determines whether interactions are recorded or replayed.
+	Mode Mode
+
+	// Strict causes requests that match no recorded interaction to fail in
+	// ModeReplay. If Strict is false, unmatched requests are forwarded to
+	// Transport and recorded.
+	Strict bool
+
+	// AnyOrder allows recorded interactions to be replayed in any order. By
+	// default, requests must be made in the order they were recorded.
+	AnyOrder bool
+
+	// Transport makes the live requests. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	path     string
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+	next     int
+}
+
+// ErrUnmatchedRequest is returned by a strict Recorder if a request matches no
+// recorded interaction.
+var ErrUnmatchedRequest = errors.New("billplztest: request does not match any recorded interaction")
+
+// responseHeaders lists the response headers kept in recorded interactions.
+var responseHeaders = []string{"Content-Type"}
+
+// NewRecorder instantiates and returns a new Recorder for the cassette file at
+// the given path.
+// In ModeReplay, the cassette is loaded from the file, and an error will be
+// returned if it cannot be read. In ModeRecord, the cassette starts empty and
+// is written to the file by Save.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		Mode: mode,
+		path: path,
+	}
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("billplztest: reading cassette %s: %v", path, err)
+	}
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// Client returns an http.Client that uses the recorder as its transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Mode == ModeReplay {
+		if res, ok := r.replay(req, recorded); ok {
+			return res, nil
+		}
+		if r.Strict {
+			return nil, fmt.Errorf("%w: %s %s", ErrUnmatchedRequest, recorded.Method, recorded.Path)
+		}
+	}
+	return r.record(req, recorded)
+}
+
+// Save writes the cassette to the recorder's file.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+// Unused returns the recorded interactions that have not been replayed. Tests
+// can use it to check that every expected request was made.
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []Interaction
+	for i, interaction := range r.cassette.Interactions {
+		if i < len(r.used) && !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := r.next; i < len(r.used); i++ {
+		if r.used[i] {
+			continue
+		}
+		if matchRequest(r.cassette.Interactions[i].Request, recorded) {
+			r.used[i] = true
+			if !r.AnyOrder {
+				r.next = i + 1
+			}
+			return newResponse(req, r.cassette.Interactions[i].Response), true
+		}
+		if !r.AnyOrder {
+			break
+		}
+	}
+	return nil, false
+}
+
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	response := RecordedResponse{
+		StatusCode: res.StatusCode,
+		Header:     http.Header{},
+		Body:       string(body),
+	}
+	for _, key := range responseHeaders {
+		if v := res.Header.Get(key); v != "" {
+			response.Header.Set(key, v)
+		}
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{recorded, response})
+	r.mu.Unlock()
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+func recordRequest(req *http.Request) (RecordedRequest, error) {
+	recorded := RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query().Encode(),
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return recorded, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return recorded, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	recorded.Body = string(bytes.TrimSpace(body))
+	return recorded, nil
+}
+
+// matchRequest reports whether two requests have the same method, path, query
+// and body. JSON bodies are compared by value, so key order does not matter.
+func matchRequest(a, b RecordedRequest) bool {
+	if a.Method != b.Method || a.Path != b.Path || a.Query != b.Query {
+		return false
+	}
+	if a.Body == b.Body {
+		return true
+	}
+	var av, bv interface{}
+	if json.Unmarshal([]byte(a.Body), &av) != nil || json.Unmarshal([]byte(b.Body), &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func newResponse(req *http.Request, recorded RecordedResponse) *http.Response {
+	header := http.Header{}
+	for key, values := range recorded.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
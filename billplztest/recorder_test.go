@@ -0,0 +1,240 @@
+package billplztest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newRecordedCassette records a GET and a POST against a test server, and
+// returns the path of the saved cassette, the server's URL, and the number of
+// requests the server received.
+func newRecordedCassette(t *testing.T) (string, string, *int32) {
+	t.Helper()
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "secret-request-id")
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(`{"method":"` + r.Method + `","path":"` + r.URL.Path + `","body":` + string(orJSONNull(body)) + `}`))
+	}))
+	t.Cleanup(server.Close)
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec, err := NewRecorder(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rec.Client()
+	doRequest(t, client, http.MethodGet, server.URL+"/v3/bills/1?page=2", "")
+	doRequest(t, client, http.MethodPost, server.URL+"/v3/bills", `{"amount":200,"name":"Ali"}`)
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return path, server.URL, &hits
+}
+
+func orJSONNull(body []byte) []byte {
+	if len(body) == 0 {
+		return []byte("null")
+	}
+	return body
+}
+
+func doRequest(t *testing.T, client *http.Client, method, url, body string) (*http.Response, string, error) {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("API_KEY", "")
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(data), nil
+}
+
+func TestRecorderRecord(t *testing.T) {
+	path, _, hits := newRecordedCassette(t)
+	if *hits != 2 {
+		t.Fatalf("server received %d requests, want 2", *hits)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"API_KEY", "QVBJX0tFWTo", "secret-request-id", "127.0.0.1"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, data)
+		}
+	}
+
+	rec, err := NewRecorder(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interactions := rec.Unused()
+	if len(interactions) != 2 {
+		t.Fatalf("cassette has %d interactions, want 2", len(interactions))
+	}
+	want := RecordedRequest{Method: http.MethodGet, Path: "/v3/bills/1", Query: "page=2"}
+	if got := interactions[0].Request; got != want {
+		t.Errorf("first request is %+v, want %+v", got, want)
+	}
+	header := interactions[0].Response.Header
+	if len(header) != 1 || header.Get("Content-Type") != "application/json" {
+		t.Errorf("recorded response headers are %v, want only Content-Type", header)
+	}
+}
+
+func TestRecorderReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		strict   bool
+		anyOrder bool
+		requests [][3]string // method, path, body
+		wantErr  []bool
+		wantHits int32
+	}{
+		{
+			name:   "strict in order",
+			strict: true,
+			requests: [][3]string{
+				{http.MethodGet, "/v3/bills/1?page=2", ""},
+				{http.MethodPost, "/v3/bills", `{"name":"Ali","amount":200}`},
+			},
+			wantErr: []bool{false, false},
+		},
+		{
+			name:   "strict out of order",
+			strict: true,
+			requests: [][3]string{
+				{http.MethodPost, "/v3/bills", `{"amount":200,"name":"Ali"}`},
+				{http.MethodGet, "/v3/bills/1?page=2", ""},
+			},
+			wantErr: []bool{true, false},
+		},
+		{
+			name:     "strict any order",
+			strict:   true,
+			anyOrder: true,
+			requests: [][3]string{
+				{http.MethodPost, "/v3/bills", `{"amount":200,"name":"Ali"}`},
+				{http.MethodGet, "/v3/bills/1?page=2", ""},
+			},
+			wantErr: []bool{false, false},
+		},
+		{
+			name:   "strict different body",
+			strict: true,
+			requests: [][3]string{
+				{http.MethodGet, "/v3/bills/1?page=2", ""},
+				{http.MethodPost, "/v3/bills", `{"amount":300,"name":"Ali"}`},
+			},
+			wantErr: []bool{false, true},
+		},
+		{
+			name: "lenient unmatched",
+			requests: [][3]string{
+				{http.MethodGet, "/v3/bills/1?page=3", ""},
+				{http.MethodGet, "/v3/bills/1?page=2", ""},
+			},
+			wantErr:  []bool{false, false},
+			wantHits: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, url, hits := newRecordedCassette(t)
+			atomic.StoreInt32(hits, 0)
+
+			rec, err := NewRecorder(path, ModeReplay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec.Strict = tt.strict
+			rec.AnyOrder = tt.anyOrder
+			client := rec.Client()
+
+			for i, r := range tt.requests {
+				res, body, err := doRequest(t, client, r[0], url+r[1], r[2])
+				if tt.wantErr[i] {
+					if !errors.Is(err, ErrUnmatchedRequest) {
+						t.Errorf("request %d: got error %v, want ErrUnmatchedRequest", i, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("request %d: %v", i, err)
+				}
+				if res.StatusCode != http.StatusOK || !strings.Contains(body, `"method":"`+r[0]+`"`) {
+					t.Errorf("request %d: got %d %s", i, res.StatusCode, body)
+				}
+			}
+			if got := atomic.LoadInt32(hits); got != tt.wantHits {
+				t.Errorf("server received %d requests, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestRecorderUnused(t *testing.T) {
+	path, url, _ := newRecordedCassette(t)
+	rec, err := NewRecorder(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Strict = true
+
+	if _, _, err := doRequest(t, rec.Client(), http.MethodGet, url+"/v3/bills/1?page=2", ""); err != nil {
+		t.Fatal(err)
+	}
+	unused := rec.Unused()
+	if len(unused) != 1 || unused[0].Request.Method != http.MethodPost {
+		t.Errorf("unused interactions are %+v, want the POST", unused)
+	}
+}
+
+func TestMatchRequest(t *testing.T) {
+	base := RecordedRequest{Method: http.MethodPost, Path: "/v3/bills", Body: `{"a":1,"b":[1,2]}`}
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"identical", `{"a":1,"b":[1,2]}`, true},
+		{"reordered keys", `{"b":[1,2],"a":1}`, true},
+		{"whitespace", "{ \"a\": 1,\n \"b\": [1, 2] }", true},
+		{"different value", `{"a":2,"b":[1,2]}`, false},
+		{"reordered array", `{"a":1,"b":[2,1]}`, false},
+		{"not JSON", `a=1&b=2`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			other.Body = tt.body
+			if got := matchRequest(base, other); got != tt.want {
+				t.Errorf("matchRequest = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,563 @@
+package billplztest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyrox18/billplz"
+)
+
+// Outcome is the result of a payment simulated by Server.SimulatePayment.
+type Outcome string
+
+// Outcomes supported by Server.SimulatePayment.
+const (
+	// OutcomePaid completes the payment and marks the bill as paid.
+	OutcomePaid Outcome = "paid"
+
+	// OutcomeFailed records a failed transaction, and leaves the bill due.
+	OutcomeFailed Outcome = "failed"
+)
+
+// ControlPath is the path of the Server's control endpoint. POSTing a JSON
+// object with the fields "bill_id", "channel" and "outcome" to it simulates a
+// payment, and responds with the resulting Payment.
+const ControlPath = "/_billplztest/payments"
+
+// paidAtLayout is the layout of the paid_at field of callbacks.
+const paidAtLayout = "2006-01-02 15:04:05 -0700"
+
+// pageSize is the number of resources returned in a page of an index.
+const pageSize = 15
+
+// ErrUnknownOutcome is returned by Server.SimulatePayment if the outcome is
+// neither OutcomePaid nor OutcomeFailed.
+var ErrUnknownOutcome = errors.New("billplztest: unknown payment outcome")
+
+// Payment represents a payment simulated by Server.SimulatePayment.
+type Payment struct {
+	// Bill is the state of the bill after the payment.
+	Bill billplz.Bill `json:"bill"`
+
+	// Transaction is the transaction recorded for the payment.
+	Transaction billplz.Transaction `json:"transaction"`
+
+	// Callback is the signed callback sent to the bill's CallbackURL.
+	Callback billplz.Callback `json:"callback"`
+
+	// CallbackStatus is the status code of the response to the callback. It
+	// is 0 if the bill has no CallbackURL, or the callback could not be sent.
+	CallbackStatus int `json:"callback_status,omitempty"`
+
+	// CallbackError describes why the callback could not be sent.
+	CallbackError string `json:"callback_error,omitempty"`
+
+	// RedirectURL is the bill's RedirectURL with the signed payment details
+	// appended, or empty if the bill has no RedirectURL.
+	RedirectURL string `json:"redirect_url,omitempty"`
+}
+
+// Server is a local stand-in for the Billplz API, implementing collections,
+// bills, transactions and payment methods in memory. Payments are simulated
+// with SimulatePayment, or by POSTing to ControlPath.
+// Bills may be created for any collection ID, including collections that were
+// not created on the server.
+type Server struct {
+	// URL is the base URL of the server, such as http://127.0.0.1:1234.
+	URL string
+
+	// APIKey, if set, must be used by clients to authenticate.
+	APIKey string
+
+	// XSignatureKey is used to sign callbacks and redirects.
+	XSignatureKey string
+
+	// HTTPClient sends callbacks. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	srv            *httptest.Server
+	mu             sync.Mutex
+	seq            int
+	collections    map[string]*billplz.Collection
+	collectionIDs  []string
+	bills          map[string]*billplz.Bill
+	transactions   map[string][]billplz.Transaction
+	paymentMethods map[string][]billplz.PaymentMethodCode
+}
+
+// NewServer starts and returns a new Server that signs callbacks and redirects
+// with the given X-Signature key. The server should be closed with Close.
+func NewServer(xSignatureKey string) *Server {
+	s := &Server{
+		XSignatureKey:  xSignatureKey,
+		collections:    make(map[string]*billplz.Collection),
+		bills:          make(map[string]*billplz.Bill),
+		transactions:   make(map[string][]billplz.Transaction),
+		paymentMethods: make(map[string][]billplz.PaymentMethodCode),
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns an http.Client that sends every request to the server,
+// whatever its host. Use it as the http.Client given to billplz.NewClient.
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{Transport: &rewriteTransport{target: target}}
+}
+
+// rewriteTransport sends requests to the target's host instead of their own.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	r.Host = ""
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// SimulatePayment simulates a payment of the bill with the given ID through the
+// given payment channel, such as "FPX".
+// A transaction is recorded for the bill, a signed callback is POSTed to the
+// bill's CallbackURL if it has one, and a signed redirect URL is built from its
+// RedirectURL. With OutcomePaid, the bill is also marked as paid.
+// A failure to deliver the callback is reported in the returned Payment. An
+// error will be returned if the bill is not found, or if it is not due.
+func (s *Server) SimulatePayment(billID, channel string, outcome Outcome) (*Payment, error) {
+	if outcome != OutcomePaid && outcome != OutcomeFailed {
+		return nil, ErrUnknownOutcome
+	}
+
+	s.mu.Lock()
+	b, ok := s.bills[billID]
+	if !ok {
+		s.mu.Unlock()
+		return nil, billplz.ErrBillNotFound
+	}
+	if b.State != "due" {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("billplztest: bill %s cannot be paid in state %s", billID, b.State)
+	}
+
+	now := s.now()
+	tx := billplz.Transaction{
+		ID:             s.nextID(),
+		Status:         "failed",
+		CompletedAt:    now.Format(time.RFC3339),
+		PaymentChannel: channel,
+	}
+	if outcome == OutcomePaid {
+		tx.Status = "completed"
+		b.Paid = billplz.Bool(true)
+		b.State = "paid"
+		b.PaidAmount = b.Amount
+	}
+	s.transactions[billID] = append(s.transactions[billID], tx)
+	p := &Payment{Bill: *b, Transaction: tx}
+	s.mu.Unlock()
+
+	p.Callback = billplz.Callback{
+		ID:                p.Bill.ID,
+		CollectionID:      p.Bill.CollectionID,
+		Paid:              billplz.BoolValue(p.Bill.Paid),
+		State:             p.Bill.State,
+		Amount:            p.Bill.Amount,
+		PaidAmount:        p.Bill.PaidAmount,
+		DueAt:             p.Bill.DueAt,
+		Email:             p.Bill.Email,
+		Mobile:            p.Bill.Mobile,
+		Name:              p.Bill.Name,
+		URL:               p.Bill.URL,
+		TransactionID:     tx.ID,
+		TransactionStatus: tx.Status,
+	}
+	if outcome == OutcomePaid {
+		p.Callback.PaidAt = now.Format(paidAtLayout)
+	}
+
+	if p.Bill.RedirectURL != "" {
+		redirect := p.Callback
+		redirect.XSignature = ""
+		u, err := s.redirectURL(p.Bill.RedirectURL, redirect.RedirectValues())
+		if err != nil {
+			return nil, err
+		}
+		p.RedirectURL = u
+	}
+
+	p.Callback.Sign(s.XSignatureKey)
+	if p.Bill.CallbackURL != "" {
+		status, err := s.sendCallback(p.Bill.CallbackURL, p.Callback.Values())
+		p.CallbackStatus = status
+		if err != nil {
+			p.CallbackError = err.Error()
+		}
+	}
+	return p, nil
+}
+
+// redirectURL appends signed payment details to a bill's redirect URL.
+func (s *Server) redirectURL(redirect string, values url.Values) (string, error) {
+	u, err := url.Parse(redirect)
+	if err != nil {
+		return "", err
+	}
+	billplz.SignValues(s.XSignatureKey, values)
+	q := u.Query()
+	for name, vs := range values {
+		q[name] = vs
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (s *Server) sendCallback(callbackURL string, values url.Values) (int, error) {
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.PostForm(callbackURL, values)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// nextID returns a new resource ID. It must be called with s.mu held.
+func (s *Server) nextID() string {
+	s.seq++
+	id := strconv.FormatInt(int64(s.seq), 36)
+	return strings.Repeat("0", 8-len(id)) + id
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == ControlPath {
+		s.serveControl(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/")
+	if !strings.HasPrefix(path, "v3/") && !strings.HasPrefix(path, "v4/") {
+		writeError(w, http.StatusNotFound, "RecordNotFound", "Not found")
+		return
+	}
+	if s.APIKey != "" {
+		if key, _, ok := r.BasicAuth(); !ok || key != s.APIKey {
+			writeError(w, http.StatusUnauthorized, "Unauthorized", "Invalid API key")
+			return
+		}
+	}
+
+	parts := strings.Split(strings.Trim(path[len("v3/"):], "/"), "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case len(parts) == 1 && parts[0] == "collections" && r.Method == http.MethodPost:
+		s.createCollection(w, r)
+	case len(parts) == 1 && parts[0] == "collections" && r.Method == http.MethodGet:
+		s.listCollections(w, r)
+	case len(parts) == 2 && parts[0] == "collections" && r.Method == http.MethodGet:
+		s.getCollection(w, parts[1])
+	case len(parts) == 3 && parts[0] == "collections" && parts[2] == "activate" && r.Method == http.MethodPost:
+		s.setCollectionStatus(w, parts[1], "active")
+	case len(parts) == 3 && parts[0] == "collections" && parts[2] == "deactivate" && r.Method == http.MethodPost:
+		s.setCollectionStatus(w, parts[1], "inactive")
+	case len(parts) == 3 && parts[0] == "collections" && parts[2] == "payment_methods" && r.Method == http.MethodGet:
+		s.getPaymentMethods(w, parts[1])
+	case len(parts) == 3 && parts[0] == "collections" && parts[2] == "payment_methods" && r.Method == http.MethodPut:
+		s.updatePaymentMethods(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "bills" && r.Method == http.MethodPost:
+		s.createBill(w, r)
+	case len(parts) == 2 && parts[0] == "bills" && r.Method == http.MethodGet:
+		s.getBill(w, parts[1])
+	case len(parts) == 2 && parts[0] == "bills" && r.Method == http.MethodDelete:
+		s.deleteBill(w, parts[1])
+	case len(parts) == 3 && parts[0] == "bills" && parts[2] == "transactions" && r.Method == http.MethodGet:
+		s.listTransactions(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "RecordNotFound", "Not found")
+	}
+}
+
+func (s *Server) serveControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Use POST")
+		return
+	}
+	var body struct {
+		BillID  string  `json:"bill_id"`
+		Channel string  `json:"channel"`
+		Outcome Outcome `json:"outcome"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	if body.Outcome == "" {
+		body.Outcome = OutcomePaid
+	}
+
+	p, err := s.SimulatePayment(body.BillID, body.Channel, body.Outcome)
+	switch {
+	case err == billplz.ErrBillNotFound:
+		writeError(w, http.StatusNotFound, "RecordNotFound", err.Error())
+	case err != nil:
+		writeError(w, http.StatusUnprocessableEntity, "RecordInvalid", err.Error())
+	default:
+		writeJSON(w, http.StatusOK, p)
+	}
+}
+
+func (s *Server) createCollection(w http.ResponseWriter, r *http.Request) {
+	var c billplz.Collection
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	if c.Title == "" {
+		writeError(w, http.StatusUnprocessableEntity, "RecordInvalid", "Title can't be blank")
+		return
+	}
+	c.ID = s.nextID()
+	c.Status = "active"
+	s.collections[c.ID] = &c
+	s.collectionIDs = append(s.collectionIDs, c.ID)
+	s.paymentMethods[c.ID] = []billplz.PaymentMethodCode{billplz.PaymentMethodFPX}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) listCollections(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	collections := []billplz.Collection{}
+	for _, id := range s.collectionIDs {
+		if c := s.collections[id]; status == "" || c.Status == status {
+			collections = append(collections, *c)
+		}
+	}
+	page := queryPage(r)
+	lo, hi := paginate(len(collections), page)
+	collections = collections[lo:hi]
+	writeJSON(w, http.StatusOK, billplz.CollectionIndexResult{
+		Collections: &collections,
+		Page:        json.Number(strconv.Itoa(page)),
+	})
+}
+
+func (s *Server) getCollection(w http.ResponseWriter, id string) {
+	c, ok := s.collections[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound", "Collection not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) setCollectionStatus(w http.ResponseWriter, id, status string) {
+	c, ok := s.collections[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound", "Collection not found")
+		return
+	}
+	if c.Status == status {
+		writeError(w, http.StatusUnprocessableEntity, "RecordInvalid", "Collection is already "+status)
+		return
+	}
+	c.Status = status
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) getPaymentMethods(w http.ResponseWriter, id string) {
+	if _, ok := s.collections[id]; !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound", "Collection not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.paymentMethodList(id))
+}
+
+func (s *Server) updatePaymentMethods(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := s.collections[id]; !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound", "Collection not found")
+		return
+	}
+	var body billplz.PaymentMethodList
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+
+	var codes []billplz.PaymentMethodCode
+	if body.PaymentMethods != nil {
+		for _, m := range *body.PaymentMethods {
+			if !m.Code.Valid() {
+				writeError(w, http.StatusUnprocessableEntity, "RecordInvalid", "Unknown payment method "+string(m.Code))
+				return
+			}
+			codes = append(codes, m.Code)
+		}
+	}
+	s.paymentMethods[id] = codes
+	writeJSON(w, http.StatusOK, s.paymentMethodList(id))
+}
+
+// paymentMethodNames lists the payment methods of every collection, in order.
+var paymentMethodNames = []struct {
+	code billplz.PaymentMethodCode
+	name string
+}{
+	{billplz.PaymentMethodFPX, "FPX"},
+	{billplz.PaymentMethodPayPal, "PayPal"},
+	{billplz.PaymentMethodBoost, "Boost"},
+	{billplz.PaymentMethodCreditCard, "Visa / Mastercard"},
+}
+
+func (s *Server) paymentMethodList(id string) billplz.PaymentMethodList {
+	active := make(map[billplz.PaymentMethodCode]bool)
+	for _, code := range s.paymentMethods[id] {
+		active[code] = true
+	}
+	methods := []billplz.PaymentMethod{}
+	for _, m := range paymentMethodNames {
+		methods = append(methods, billplz.PaymentMethod{
+			Code:   m.code,
+			Name:   m.name,
+			Active: billplz.Bool(active[m.code]),
+		})
+	}
+	return billplz.PaymentMethodList{PaymentMethods: &methods}
+}
+
+func (s *Server) createBill(w http.ResponseWriter, r *http.Request) {
+	var b billplz.Bill
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	if b.CollectionID == "" || b.Amount == 0 {
+		writeError(w, http.StatusUnprocessableEntity, "RecordInvalid", "Collection and amount can't be blank")
+		return
+	}
+	b.ID = s.nextID()
+	b.Paid = billplz.Bool(false)
+	b.State = "due"
+	b.PaidAmount = 0
+	b.URL = s.URL + "/bills/" + b.ID
+	s.bills[b.ID] = &b
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) getBill(w http.ResponseWriter, id string) {
+	b, ok := s.bills[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound", "Bill not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) deleteBill(w http.ResponseWriter, id string) {
+	b, ok := s.bills[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound", "Bill not found")
+		return
+	}
+	if b.State != "due" {
+		writeError(w, http.StatusUnprocessableEntity, "RecordInvalid", "Bill cannot be deleted in state "+b.State)
+		return
+	}
+	b.State = "deleted"
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) listTransactions(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := s.bills[id]; !ok {
+		writeError(w, http.StatusNotFound, "RecordNotFound", "Bill not found")
+		return
+	}
+	status := r.URL.Query().Get("status")
+	// Billplz lists the most recent transactions first.
+	transactions := []billplz.Transaction{}
+	recorded := s.transactions[id]
+	for i := len(recorded) - 1; i >= 0; i-- {
+		if status == "" || recorded[i].Status == status {
+			transactions = append(transactions, recorded[i])
+		}
+	}
+
+	page := queryPage(r)
+	lo, hi := paginate(len(transactions), page)
+	transactions = transactions[lo:hi]
+	writeJSON(w, http.StatusOK, billplz.BillTransactions{
+		BillID:       id,
+		Transactions: &transactions,
+		Page:         json.Number(strconv.Itoa(page)),
+	})
+}
+
+func queryPage(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// paginate returns the bounds of the given page in a list of n resources.
+func paginate(n, page int) (int, int) {
+	lo := (page - 1) * pageSize
+	if lo > n {
+		lo = n
+	}
+	hi := lo + pageSize
+	if hi > n {
+		hi = n
+	}
+	return lo, hi
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	var body struct {
+		Error struct {
+			Type    string   `json:"type"`
+			Message []string `json:"message"`
+		} `json:"error"`
+	}
+	body.Error.Type = errType
+	body.Error.Message = []string{message}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,280 @@
+package billplztest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pyrox18/billplz"
+)
+
+const testXSignatureKey = "S-test-x-signature-key"
+
+// newTestServer starts a Server, and returns it with a Client talking to it.
+func newTestServer(t *testing.T) (*Server, *billplz.Client) {
+	t.Helper()
+	s := NewServer(testXSignatureKey)
+	t.Cleanup(s.Close)
+	s.APIKey = "test-api-key"
+	s.Now = func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	c, err := billplz.NewClient(s.Client(), s.APIKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+// newCallbackReceiver starts a server parsing the callbacks it receives, and
+// sending them to the returned channel.
+func newCallbackReceiver(t *testing.T) (string, <-chan *billplz.Callback) {
+	t.Helper()
+	received := make(chan *billplz.Callback, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := billplz.ParseCallback(r, testXSignatureKey)
+		if err != nil {
+			t.Errorf("ParseCallback() = %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- c
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver.URL, received
+}
+
+func createTestBill(t *testing.T, c *billplz.Client, callbackURL string) *billplz.Bill {
+	t.Helper()
+	collection, err := c.CreateCollection(billplz.Collection{Title: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.CreateBill(billplz.Bill{
+		CollectionID: collection.ID,
+		Email:        "api@billplz.com",
+		Name:         "Michael API V3",
+		Amount:       200,
+		CallbackURL:  callbackURL,
+		RedirectURL:  "https://example.com/return?order=42",
+		Description:  "Maecenas eu placerat ante.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSimulatePayment(t *testing.T) {
+	s, c := newTestServer(t)
+	callbackURL, received := newCallbackReceiver(t)
+	b := createTestBill(t, c, callbackURL)
+
+	p, err := s.SimulatePayment(b.ID, "FPX", OutcomePaid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CallbackStatus != http.StatusOK || p.CallbackError != "" {
+		t.Errorf("callback delivered with status %d, error %q", p.CallbackStatus, p.CallbackError)
+	}
+
+	callback := <-received
+	if callback.ID != b.ID || !callback.Paid || callback.State != "paid" || callback.PaidAmount != 200 {
+		t.Errorf("callback = %+v, want bill %s paid in full", callback, b.ID)
+	}
+	if callback.TransactionID != p.Transaction.ID || callback.TransactionStatus != "completed" {
+		t.Errorf("callback transaction = %s %s, want %s completed", callback.TransactionID, callback.TransactionStatus, p.Transaction.ID)
+	}
+	if callback.PaidAt != "2020-01-02 03:04:05 +0000" {
+		t.Errorf("callback paid at = %q", callback.PaidAt)
+	}
+
+	got, err := c.GetBill(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !billplz.BoolValue(got.Paid) || got.State != "paid" || got.PaidAmount != 200 {
+		t.Errorf("GetBill() = %+v, want the bill paid", got)
+	}
+	transactions, err := c.GetBillTransactions(b.ID, 1, "completed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*transactions.Transactions) != 1 || (*transactions.Transactions)[0].PaymentChannel != "FPX" {
+		t.Errorf("GetBillTransactions() = %+v, want the FPX transaction", *transactions.Transactions)
+	}
+
+	if _, err := s.SimulatePayment(b.ID, "FPX", OutcomePaid); err == nil {
+		t.Error("SimulatePayment() of a paid bill succeeded")
+	}
+	if err := c.DeleteBill(b.ID); err == nil {
+		t.Error("DeleteBill() of a paid bill succeeded")
+	}
+}
+
+func TestSimulatePaymentFailed(t *testing.T) {
+	s, c := newTestServer(t)
+	callbackURL, received := newCallbackReceiver(t)
+	b := createTestBill(t, c, callbackURL)
+
+	p, err := s.SimulatePayment(b.ID, "BOOST", OutcomeFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := <-received
+	if callback.Paid || callback.State != "due" || callback.PaidAt != "" || callback.TransactionStatus != "failed" {
+		t.Errorf("callback = %+v, want a failed payment of a due bill", callback)
+	}
+	if p.Transaction.Status != "failed" {
+		t.Errorf("transaction status = %q, want failed", p.Transaction.Status)
+	}
+
+	got, err := c.GetBill(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if billplz.BoolValue(got.Paid) || got.State != "due" {
+		t.Errorf("GetBill() = %+v, want the bill due", got)
+	}
+	if _, err := s.SimulatePayment(b.ID, "FPX", OutcomePaid); err != nil {
+		t.Errorf("SimulatePayment() after a failed payment = %v", err)
+	}
+}
+
+func TestSimulatePaymentErrors(t *testing.T) {
+	s, c := newTestServer(t)
+	callbackURL, _ := newCallbackReceiver(t)
+	b := createTestBill(t, c, callbackURL)
+
+	if _, err := s.SimulatePayment("missing", "FPX", OutcomePaid); err != billplz.ErrBillNotFound {
+		t.Errorf("SimulatePayment() of a missing bill = %v, want ErrBillNotFound", err)
+	}
+	if _, err := s.SimulatePayment(b.ID, "FPX", "refunded"); err != ErrUnknownOutcome {
+		t.Errorf("SimulatePayment() with an unknown outcome = %v, want ErrUnknownOutcome", err)
+	}
+
+	if err := c.DeleteBill(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SimulatePayment(b.ID, "FPX", OutcomePaid); err == nil {
+		t.Error("SimulatePayment() of a deleted bill succeeded")
+	}
+}
+
+func TestSimulatePaymentCallbackFailure(t *testing.T) {
+	s, c := newTestServer(t)
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	receiver.Close()
+	b := createTestBill(t, c, receiver.URL)
+
+	p, err := s.SimulatePayment(b.ID, "FPX", OutcomePaid)
+	if err != nil {
+		t.Fatalf("SimulatePayment() = %v, want the failed callback reported in the payment", err)
+	}
+	if p.CallbackStatus != 0 || p.CallbackError == "" {
+		t.Errorf("callback status %d, error %q, want an error", p.CallbackStatus, p.CallbackError)
+	}
+}
+
+func TestSimulatePaymentRedirect(t *testing.T) {
+	s, c := newTestServer(t)
+	callbackURL, _ := newCallbackReceiver(t)
+	b := createTestBill(t, c, callbackURL)
+
+	p, err := s.SimulatePayment(b.ID, "FPX", OutcomePaid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, p.RedirectURL, nil)
+	if r.URL.Query().Get("order") != "42" {
+		t.Errorf("redirect URL %s lost the original query", p.RedirectURL)
+	}
+	redirect, err := billplz.ParseRedirect(r, testXSignatureKey)
+	if err != nil {
+		t.Fatalf("ParseRedirect(%s) = %v", p.RedirectURL, err)
+	}
+	if redirect.ID != b.ID || !redirect.Paid || redirect.TransactionID != p.Transaction.ID {
+		t.Errorf("ParseRedirect() = %+v, want bill %s paid by %s", redirect, b.ID, p.Transaction.ID)
+	}
+
+	if _, err := billplz.ParseRedirect(r, "S-other-key"); err != billplz.ErrInvalidSignature {
+		t.Errorf("ParseRedirect() with another key = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestControlEndpoint(t *testing.T) {
+	s, c := newTestServer(t)
+	callbackURL, _ := newCallbackReceiver(t)
+	b := createTestBill(t, c, callbackURL)
+
+	post := func(body string) (*http.Response, *Payment) {
+		t.Helper()
+		resp, err := http.Post(s.URL+ControlPath, "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var p Payment
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp, &p
+	}
+
+	resp, _ := post(`{"bill_id":"missing"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("payment of a missing bill responded with %d, want 404", resp.StatusCode)
+	}
+	resp, _ = post(`{"bill_id":"` + b.ID + `","outcome":"refunded"}`)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("payment with an unknown outcome responded with %d, want 422", resp.StatusCode)
+	}
+	resp, _ = post(`{`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("malformed payment responded with %d, want 400", resp.StatusCode)
+	}
+
+	// The outcome defaults to paid.
+	resp, p := post(`{"bill_id":"` + b.ID + `","channel":"FPX"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("payment responded with %d, want 200", resp.StatusCode)
+	}
+	if p.Bill.ID != b.ID || p.Bill.State != "paid" || p.Transaction.PaymentChannel != "FPX" {
+		t.Errorf("payment = %+v, want bill %s paid through FPX", p, b.ID)
+	}
+	if err := billplz.VerifyXSignature(testXSignatureKey, p.Callback.Values()); err != nil {
+		t.Errorf("callback in response is not signed: %v", err)
+	}
+
+	got, err := c.GetBill(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != "paid" {
+		t.Errorf("GetBill() state = %q, want paid", got.State)
+	}
+
+	get, err := http.Get(s.URL + ControlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get.Body.Close()
+	if get.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET of the control endpoint responded with %d, want 405", get.StatusCode)
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	s, _ := newTestServer(t)
+	c, err := billplz.NewClient(s.Client(), "wrong-key", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetBill("missing"); err != billplz.ErrUnauthorized {
+		t.Errorf("GetBill() with a wrong key = %v, want ErrUnauthorized", err)
+	}
+}
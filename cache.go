@@ -0,0 +1,250 @@
+package billplz
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Cache stores the JSON encoding of API responses for a Client. Implementations
+// must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored under the given key, and false if there is
+	// none or it has expired.
+	Get(key string) ([]byte, bool)
+
+	// Set stores a value under the given key for the given duration.
+	Set(key string, value []byte, ttl time.Duration)
+
+	// Delete removes the value stored under the given key, if any.
+	Delete(key string)
+}
+
+// CacheTTL sets how long each kind of resource is cached by a Client. Zero
+// values are replaced with a default of 5 minutes, and resources with a
+// negative TTL are not cached.
+type CacheTTL struct {
+	Collection     time.Duration
+	OpenCollection time.Duration
+	PaymentMethods time.Duration
+}
+
+func cacheTTL(ttl time.Duration) time.Duration {
+	if ttl == 0 {
+		return defaultCacheTTL
+	}
+	return ttl
+}
+
+// LRUCache is a Cache that keeps a bounded number of values in memory, evicting
+// the least recently used value when it is full. It is safe for concurrent use.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	entries *list.List
+	items   map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUCache instantiates and returns an empty LRUCache holding up to size
+// values.
+func NewLRUCache(size int) *LRUCache {
+	if size < 1 {
+		size = 1
+	}
+	return &LRUCache{
+		size:    size,
+		entries: list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache.
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(e)
+		return nil, false
+	}
+	c.entries.MoveToFront(e)
+	return entry.value, true
+}
+
+// Set implements Cache.
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(ttl)
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		c.entries.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.entries.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.entries.Len() > c.size {
+		c.remove(c.entries.Back())
+	}
+}
+
+// Delete implements Cache.
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+}
+
+// remove removes an entry. It must be called with c.mu held.
+func (c *LRUCache) remove(e *list.Element) {
+	c.entries.Remove(e)
+	delete(c.items, e.Value.(*lruEntry).key)
+}
+
+// flightGroup coalesces concurrent fetches of the same cache key, and keeps
+// fetches that started before an invalidation from caching stale values.
+type flightGroup struct {
+	mu      sync.Mutex
+	calls   map[string]*flightCall
+	version map[string]uint64
+}
+
+type flightCall struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// do calls fetch once for all concurrent callers with the same key, and caches
+// its encoded result unless the key is invalidated in the meantime.
+func (g *flightGroup) do(key string, cache Cache, ttl time.Duration, fetch func() (interface{}, error)) ([]byte, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	version := g.version[key]
+	g.mu.Unlock()
+
+	v, err := fetch()
+	if err == nil {
+		call.value, call.err = json.Marshal(v)
+	} else {
+		call.err = err
+	}
+
+	g.mu.Lock()
+	if call.err == nil && g.version[key] == version {
+		cache.Set(key, call.value, ttl)
+	}
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+	return call.value, call.err
+}
+
+// invalidate removes the value cached under the given key, and prevents
+// fetches in flight from caching their result.
+func (g *flightGroup) invalidate(key string, cache Cache) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.version == nil {
+		g.version = make(map[string]uint64)
+	}
+	g.version[key]++
+	cache.Delete(key)
+}
+
+// flightsMu guards the creation of Client.flights on first use by clients
+// built without NewClient. Client is not given a mutex of its own, as
+// it is copied by value, such as by Ping.
+var flightsMu sync.Mutex
+
+// flightGroup returns the client's flightGroup, creating it on first use.
+func (c *Client) flightGroup() *flightGroup {
+	flightsMu.Lock()
+	defer flightsMu.Unlock()
+	if c.flights == nil {
+		c.flights = &flightGroup{}
+	}
+	return c.flights
+}
+
+// caches reports whether the client caches resources with the given TTL.
+func (c *Client) caches(ttl time.Duration) bool {
+	return c.Cache != nil && ttl >= 0
+}
+
+// cacheKey scopes a cache key to the client's endpoint and API key, so that
+// clients of different accounts or environments sharing a Cache never see each
+// other's values. The API key is hashed, so that it is not exposed to the
+// Cache.
+func (c *Client) cacheKey(ctx context.Context, key string) (string, error) {
+	apiKey, err := c.apiKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return c.baseURL.String() + "|" + hex.EncodeToString(sum[:8]) + "|" + key, nil
+}
+
+// cached decodes the value cached under the given key into v, or calls fetch
+// and caches its result if there is none. Concurrent misses for the same key
+// share a single call to fetch, made with the context of the first caller.
+func (c *Client) cached(ctx context.Context, key string, ttl time.Duration, v interface{}, fetch func(ctx context.Context) (interface{}, error)) error {
+	key, err := c.cacheKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	data, ok := c.Cache.Get(key)
+	if !ok {
+		data, err = c.flightGroup().do(key, c.Cache, ttl, func() (interface{}, error) {
+			return fetch(ctx)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// invalidate removes the values cached under the given keys.
+func (c *Client) invalidate(keys ...string) {
+	if c.Cache == nil {
+		return
+	}
+	for _, key := range keys {
+		// Without an API key, nothing can have been cached for the client.
+		if key, err := c.cacheKey(context.Background(), key); err == nil {
+			c.flightGroup().invalidate(key, c.Cache)
+		}
+	}
+}
+
+func collectionCacheKey(id string) string     { return "collection:" + id }
+func openCollectionCacheKey(id string) string { return "open_collection:" + id }
+func paymentMethodsCacheKey(id string) string { return "payment_methods:" + id }
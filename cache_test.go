@@ -0,0 +1,304 @@
+package billplz
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := NewLRUCache(3)
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), time.Minute)
+	c.Set("c", []byte("3"), time.Minute)
+	c.Get("a")                           // b is now the least recently used
+	c.Set("d", []byte("4"), time.Minute) // evicts b
+	c.Set("c", []byte("5"), time.Minute) // a is now the least recently used
+	c.Set("e", []byte("6"), time.Minute) // evicts a
+
+	for key, want := range map[string]string{"a": "", "b": "", "c": "5", "d": "4", "e": "6"} {
+		value, ok := c.Get(key)
+		if ok != (want != "") || string(value) != want {
+			t.Errorf("Get(%q) = %q, %v, want %q", key, value, ok, want)
+		}
+	}
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	c := NewLRUCache(2)
+	c.Set("a", []byte("1"), time.Millisecond)
+	c.Set("b", []byte("2"), time.Minute)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("expired value was returned")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("unexpired value was not returned")
+	}
+	c.Delete("b")
+	if _, ok := c.Get("b"); ok {
+		t.Error("deleted value was returned")
+	}
+}
+
+func TestLRUCacheConcurrent(t *testing.T) {
+	c := NewLRUCache(8)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprint((i + j) % 12)
+				c.Set(key, []byte(key), time.Minute)
+				c.Get(key)
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := c.entries.Len(); n > 8 || n != len(c.items) {
+		t.Errorf("cache holds %d entries and %d items, want at most 8 of each", n, len(c.items))
+	}
+}
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	var g flightGroup
+	cache := NewLRUCache(10)
+	var calls int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := g.do("key", cache, time.Minute, func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "value", nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = string(data)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("fetch called %d times, want 1", calls)
+	}
+	for i, result := range results {
+		if result != `"value"` {
+			t.Errorf("caller %d got %s", i, result)
+		}
+	}
+	if data, ok := cache.Get("key"); !ok || string(data) != `"value"` {
+		t.Errorf("cached %s, %v", data, ok)
+	}
+}
+
+func TestFlightGroupInvalidateDuringFlight(t *testing.T) {
+	var g flightGroup
+	cache := NewLRUCache(10)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := g.do("key", cache, time.Minute, func() (interface{}, error) {
+			close(started)
+			<-release
+			return "stale", nil
+		})
+		done <- data
+	}()
+
+	<-started
+	g.invalidate("key", cache)
+	close(release)
+
+	if data := <-done; string(data) != `"stale"` {
+		t.Errorf("caller got %s", data)
+	}
+	if data, ok := cache.Get("key"); ok {
+		t.Errorf("value fetched before the invalidation was cached: %s", data)
+	}
+
+	if _, err := g.do("key", cache, time.Minute, func() (interface{}, error) { return "fresh", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := cache.Get("key"); !ok || string(data) != `"fresh"` {
+		t.Errorf("cached %s, %v after a fetch following the invalidation", data, ok)
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	var gets, methodGets int32
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v3/collections/inbmmepb":
+			atomic.AddInt32(&gets, 1)
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(`{"id":"inbmmepb","title":"My First API Collection"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/v3/collections/inbmmepb/deactivate":
+			w.Write([]byte(`{}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v3/collections/inbmmepb/payment_methods":
+			atomic.AddInt32(&methodGets, 1)
+			w.Write([]byte(`{"payment_methods":[{"code":"fpx","name":"Online Banking","active":true}]}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/v3/collections/inbmmepb/payment_methods":
+			w.Write([]byte(`{"payment_methods":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	c.Cache = NewLRUCache(10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collection, err := c.GetCollection("inbmmepb")
+			if err != nil || collection.Title != "My First API Collection" {
+				t.Errorf("GetCollection() = %+v, %v", collection, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if gets != 1 {
+		t.Errorf("concurrent misses made %d requests, want 1", gets)
+	}
+
+	if err := c.DeactivateCollection("inbmmepb"); err != nil {
+		t.Fatal(err)
+	}
+	c.GetCollection("inbmmepb")
+	if gets != 2 {
+		t.Errorf("made %d requests after DeactivateCollection, want 2", gets)
+	}
+
+	c.GetPaymentMethodIndex("inbmmepb")
+	methods, err := c.GetPaymentMethodIndex("inbmmepb")
+	if err != nil || methods == nil || len(*methods) != 1 || (*methods)[0].Code != PaymentMethodFPX {
+		t.Errorf("GetPaymentMethodIndex() = %v, %v", methods, err)
+	}
+	if _, err := c.UpdatePaymentMethods("inbmmepb", []PaymentMethodCode{PaymentMethodFPX}); err != nil {
+		t.Fatal(err)
+	}
+	c.GetPaymentMethodIndex("inbmmepb")
+	if methodGets != 2 {
+		t.Errorf("made %d payment method requests, want 2", methodGets)
+	}
+
+	if _, err := c.GetCollection("missing"); err != ErrCollectionNotFound {
+		t.Errorf("GetCollection(missing) = %v, want ErrCollectionNotFound", err)
+	}
+
+	c.CacheTTL.Collection = -1
+	c.GetCollection("inbmmepb")
+	if gets != 3 {
+		t.Errorf("made %d requests with caching disabled, want 3", gets)
+	}
+}
+
+// collectionServer serves a collection with an unmodelled field, counting the
+// requests it receives.
+func collectionServer(t *testing.T, gets *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(gets, 1)
+		w.Write([]byte(`{"id":"inbmmepb","title":"My First API Collection","unmodelled":1}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientCacheWithoutNewClient(t *testing.T) {
+	var gets int32
+	server := collectionServer(t, &gets)
+	u, _ := url.Parse(server.URL)
+	c := &Client{baseURL: u, httpClient: server.Client(), APIKey: "API_KEY", Cache: NewLRUCache(10)}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetCollection("inbmmepb"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gets != 1 {
+		t.Errorf("made %d requests, want 1", gets)
+	}
+	if err := c.DeactivateCollection("inbmmepb"); err != nil {
+		t.Fatal(err)
+	}
+	c.GetCollection("inbmmepb")
+	if gets != 3 {
+		t.Errorf("made %d requests after DeactivateCollection, want 3", gets)
+	}
+}
+
+func TestClientCacheScope(t *testing.T) {
+	var gets int32
+	sandbox, production := collectionServer(t, &gets), collectionServer(t, &gets)
+	cache := NewLRUCache(10)
+	client := func(server *httptest.Server, key string) *Client {
+		u, _ := url.Parse(server.URL)
+		return &Client{baseURL: u, httpClient: server.Client(), APIKey: key, Cache: cache}
+	}
+
+	clients := []*Client{
+		client(sandbox, "first-key"),
+		client(sandbox, "second-key"),
+		client(production, "first-key"),
+		client(sandbox, "first-key"),
+	}
+	for _, c := range clients {
+		if _, err := c.GetCollection("inbmmepb"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gets != 3 {
+		t.Errorf("made %d requests, want one for each account and environment", gets)
+	}
+	for key := range cache.items {
+		if strings.Contains(key, "first-key") || strings.Contains(key, "second-key") {
+			t.Errorf("cache key %q contains the API key", key)
+		}
+	}
+
+	c := client(sandbox, "")
+	if _, err := c.GetCollection("inbmmepb"); err != ErrNoCredentials {
+		t.Errorf("GetCollection() without an API key = %v, want ErrNoCredentials", err)
+	}
+}
+
+func TestClientCacheKeepsExtra(t *testing.T) {
+	var gets int32
+	server := collectionServer(t, &gets)
+	u, _ := url.Parse(server.URL)
+	c := &Client{baseURL: u, httpClient: server.Client(), APIKey: "API_KEY", Cache: NewLRUCache(10)}
+
+	c.GetCollection("inbmmepb")
+	collection, err := c.GetCollection("inbmmepb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gets != 1 {
+		t.Fatalf("made %d requests, want the second collection from the cache", gets)
+	}
+	if string(collection.Extra["unmodelled"]) != "1" {
+		t.Errorf("cached collection Extra = %s, want the unmodelled field", collection.Extra)
+	}
+}
@@ -0,0 +1,543 @@
+package billplz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CallbackStatus represents the processing state of a callback received by a
+// CallbackProcessor.
+type CallbackStatus string
+
+// Processing states of a received callback.
+const (
+	// CallbackPending callbacks are waiting to be handled, or to be retried
+	// after a failure.
+	CallbackPending CallbackStatus = "pending"
+
+	// CallbackProcessed callbacks were handled successfully.
+	CallbackProcessed CallbackStatus = "processed"
+
+	// CallbackFailed callbacks failed MaxAttempts times, and are no longer
+	// retried until they are replayed with CallbackProcessor.Replay.
+	CallbackFailed CallbackStatus = "failed"
+)
+
+// Default values used by CallbackProcessor.
+const (
+	defaultCallbackMaxAttempts  = 5
+	defaultCallbackRetryBackoff = time.Minute
+	defaultCallbackMaxBackoff   = 24 * time.Hour
+	defaultCallbackInterval     = 10 * time.Second
+)
+
+// CallbackRecord represents a callback received by a CallbackProcessor, and the
+// progress of its processing.
+type CallbackRecord struct {
+	// Key identifies the bill update carried by the callback. See CallbackKey.
+	Key string `json:"key"`
+
+	// SignatureKeyID is the ID of the X-Signature key that verified the
+	// callback.
+	SignatureKeyID string `json:"signature_key_id,omitempty"`
+
+	Callback      Callback       `json:"callback"`
+	Status        CallbackStatus `json:"status"`
+	Attempts      int            `json:"attempts"`
+	LastError     string         `json:"last_error,omitempty"`
+	ReceivedAt    time.Time      `json:"received_at"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	ProcessedAt   time.Time      `json:"processed_at"`
+}
+
+// CallbackKey returns the key identifying the bill update carried by a
+// callback, made of the bill ID, state and paid_at time. Billplz retries
+// callbacks until they are acknowledged, so callbacks with the same key are
+// duplicates.
+func CallbackKey(c *Callback) string {
+	return c.ID + "|" + c.State + "|" + c.PaidAt
+}
+
+// CallbackStore persists the callbacks received by a CallbackProcessor.
+type CallbackStore interface {
+	// Add saves a new record. It returns false without saving anything if a
+	// record with the same key exists.
+	Add(ctx context.Context, record CallbackRecord) (bool, error)
+
+	// Get returns the record with the given key, or ErrCallbackNotFound if
+	// there is none.
+	Get(ctx context.Context, key string) (*CallbackRecord, error)
+
+	// Save replaces the record with the record's key.
+	Save(ctx context.Context, record CallbackRecord) error
+
+	// List returns the records with the given status, oldest first.
+	List(ctx context.Context, status CallbackStatus) ([]CallbackRecord, error)
+}
+
+// MemoryCallbackStore is a CallbackStore that keeps records in memory.
+// It is safe for concurrent use.
+type MemoryCallbackStore struct {
+	mu      sync.RWMutex
+	records map[string]CallbackRecord
+}
+
+// NewMemoryCallbackStore instantiates and returns an empty MemoryCallbackStore.
+func NewMemoryCallbackStore() *MemoryCallbackStore {
+	return &MemoryCallbackStore{records: make(map[string]CallbackRecord)}
+}
+
+// Add implements CallbackStore.
+func (s *MemoryCallbackStore) Add(ctx context.Context, record CallbackRecord) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[record.Key]; ok {
+		return false, nil
+	}
+	s.records[record.Key] = record
+	return true, nil
+}
+
+// Get implements CallbackStore.
+func (s *MemoryCallbackStore) Get(ctx context.Context, key string) (*CallbackRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.records[key]
+	if !ok {
+		return nil, ErrCallbackNotFound
+	}
+	return &record, nil
+}
+
+// Save implements CallbackStore.
+func (s *MemoryCallbackStore) Save(ctx context.Context, record CallbackRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.Key] = record
+	return nil
+}
+
+// List implements CallbackStore.
+func (s *MemoryCallbackStore) List(ctx context.Context, status CallbackStatus) ([]CallbackRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := []CallbackRecord{}
+	for _, record := range s.records {
+		if record.Status == status {
+			records = append(records, record)
+		}
+	}
+	sortCallbackRecords(records)
+	return records, nil
+}
+
+func (s *MemoryCallbackStore) all() []CallbackRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]CallbackRecord, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	sortCallbackRecords(records)
+	return records
+}
+
+func sortCallbackRecords(records []CallbackRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].ReceivedAt.Equal(records[j].ReceivedAt) {
+			return records[i].ReceivedAt.Before(records[j].ReceivedAt)
+		}
+		return records[i].Key < records[j].Key
+	})
+}
+
+// FileCallbackStore is a CallbackStore that keeps records in a JSON file. The
+// file is rewritten atomically on every change, so it is meant for modest
+// volumes of callbacks. It is safe for concurrent use within a process.
+type FileCallbackStore struct {
+	path string
+	mu   sync.Mutex
+	mem  *MemoryCallbackStore
+}
+
+// NewFileCallbackStore instantiates and returns a FileCallbackStore backed by
+// the file at the given path, loading its records if the file exists.
+// An error will be returned if the file exists but cannot be read.
+func NewFileCallbackStore(path string) (*FileCallbackStore, error) {
+	s := &FileCallbackStore{path: path, mem: NewMemoryCallbackStore()}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []CallbackRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		s.mem.records[record.Key] = record
+	}
+	return s, nil
+}
+
+// Add implements CallbackStore.
+func (s *FileCallbackStore) Add(ctx context.Context, record CallbackRecord) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.mem.Get(ctx, record.Key); err == nil {
+		return false, nil
+	}
+	if err := s.flush(s.withRecord(record)); err != nil {
+		return false, err
+	}
+	return s.mem.Add(ctx, record)
+}
+
+// Get implements CallbackStore.
+func (s *FileCallbackStore) Get(ctx context.Context, key string) (*CallbackRecord, error) {
+	return s.mem.Get(ctx, key)
+}
+
+// Save implements CallbackStore. The record is only replaced in memory once the
+// file is written, so that a failed write leaves the store unchanged.
+func (s *FileCallbackStore) Save(ctx context.Context, record CallbackRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.flush(s.withRecord(record)); err != nil {
+		return err
+	}
+	return s.mem.Save(ctx, record)
+}
+
+// List implements CallbackStore.
+func (s *FileCallbackStore) List(ctx context.Context, status CallbackStatus) ([]CallbackRecord, error) {
+	return s.mem.List(ctx, status)
+}
+
+// withRecord returns all records of the store, with the given record added or
+// replacing the record with the same key. It must be called with s.mu held.
+func (s *FileCallbackStore) withRecord(record CallbackRecord) []CallbackRecord {
+	records := s.mem.all()
+	for i := range records {
+		if records[i].Key == record.Key {
+			records[i] = record
+			return records
+		}
+	}
+	records = append(records, record)
+	sortCallbackRecords(records)
+	return records
+}
+
+// flush writes the given records to a temporary file, and renames it over the
+// store's file. It must be called with s.mu held.
+func (s *FileCallbackStore) flush(records []CallbackRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// CallbackHandler handles a verified callback, such as by fulfilling the order
+// paid by the bill. A handler may be called more than once for the same
+// callback if it fails, or if the process stops before the success is saved.
+type CallbackHandler func(ctx context.Context, c *Callback) error
+
+// CallbackProcessor receives callbacks from Billplz, persists them in Store,
+// and hands them to Handler once per bill update. Failed callbacks are retried
+// with backoff, and set aside as failed after MaxAttempts attempts.
+// A CallbackProcessor is an http.Handler, to be mounted at the path used as the
+// CallbackURL of bills. Callbacks are handled by Run, in the background.
+type CallbackProcessor struct {
+	Store   CallbackStore
+	Handler CallbackHandler
+
+	// XSignatureKey is used to verify the signature of received callbacks if
+	// Keys is nil.
+	XSignatureKey string
+
+	// Keys, if set, holds the keys accepted while the X-Signature key is
+	// rotated.
+	Keys *SignatureKeySet
+
+	// MaxAttempts is the number of times a callback is handled before it is
+	// set aside as failed. Defaults to 5.
+	MaxAttempts int
+
+	// RetryBackoff is the delay before the first retry of a failed callback,
+	// doubled on every following retry. Defaults to 1 minute.
+	RetryBackoff time.Duration
+
+	// MaxRetryBackoff caps the delay between two retries of a failed callback.
+	// Defaults to 24 hours.
+	MaxRetryBackoff time.Duration
+
+	// Interval is the delay between two checks for callbacks due for a retry
+	// when running Run. New callbacks are handled immediately. Defaults to
+	// 10 seconds.
+	Interval time.Duration
+
+	// OnError, if set, is called by Run with the error of every run of
+	// ProcessPending that fails, such as when a handler or the store fails.
+	OnError func(error)
+
+	wakeOnce sync.Once
+	wake     chan struct{}
+}
+
+// NewCallbackProcessor instantiates and returns a new CallbackProcessor.
+// If a store is not supplied, an in-memory store will be used.
+func NewCallbackProcessor(store CallbackStore, xSignatureKey string, handler CallbackHandler) *CallbackProcessor {
+	if store == nil {
+		store = NewMemoryCallbackStore()
+	}
+	return &CallbackProcessor{
+		Store:         store,
+		Handler:       handler,
+		XSignatureKey: xSignatureKey,
+	}
+}
+
+// ServeHTTP implements http.Handler. Callbacks are acknowledged once they are
+// saved, before they are handled. Callbacks with an invalid signature are
+// rejected with 403 Forbidden, and all callbacks are rejected with 500 Internal
+// Server Error if no X-Signature key or Handler is configured, so that Billplz
+// retries them once the processor is set up.
+func (p *CallbackProcessor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if p.Handler == nil {
+		http.Error(w, ErrNoCallbackHandler.Error(), http.StatusInternalServerError)
+		return
+	}
+	keys := p.Keys
+	if keys == nil {
+		keys = &SignatureKeySet{Current: SignatureKey{Key: p.XSignatureKey}}
+	}
+	c, key, err := keys.ParseCallback(r)
+	if err == ErrNoSignatureKey {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == ErrInvalidSignature {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := p.receive(r.Context(), c, key.ID); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Receive saves a callback to be handled by Run. It returns false if the
+// callback is a duplicate of one received before.
+// Receive does not check the callback's X-Signature: callers must only pass
+// callbacks verified with ParseCallback or SignatureKeySet.ParseCallback, or
+// the handler will act on forged payments. ServeHTTP verifies callbacks before
+// receiving them.
+func (p *CallbackProcessor) Receive(ctx context.Context, c *Callback) (bool, error) {
+	return p.receive(ctx, c, "")
+}
+
+func (p *CallbackProcessor) receive(ctx context.Context, c *Callback, keyID string) (bool, error) {
+	now := time.Now()
+	added, err := p.Store.Add(ctx, CallbackRecord{
+		Key:            CallbackKey(c),
+		SignatureKeyID: keyID,
+		Callback:       *c,
+		Status:         CallbackPending,
+		ReceivedAt:     now,
+		NextAttemptAt:  now,
+	})
+	if added {
+		p.notify()
+	}
+	return added, err
+}
+
+// Run handles pending callbacks as they are received, and retries failed ones
+// when they are due, until ctx is done. Errors do not stop Run; they are passed
+// to OnError.
+// ErrNoCallbackHandler is returned immediately if the processor has no Handler.
+func (p *CallbackProcessor) Run(ctx context.Context) error {
+	if p.Handler == nil {
+		return ErrNoCallbackHandler
+	}
+	interval := p.Interval
+	if interval <= 0 {
+		interval = defaultCallbackInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	wake := p.wakeChan()
+	for {
+		if err := p.ProcessPending(ctx); err != nil && ctx.Err() == nil && p.OnError != nil {
+			p.OnError(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ProcessPending handles every pending callback that is due once, and saves
+// the outcome.
+// The returned error is the error of the first callback that could not be
+// handled or saved, noting how many other callbacks failed.
+// ErrNoCallbackHandler is returned if the processor has no Handler.
+func (p *CallbackProcessor) ProcessPending(ctx context.Context) error {
+	if p.Handler == nil {
+		return ErrNoCallbackHandler
+	}
+	records, err := p.Store.List(ctx, CallbackPending)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	now := time.Now()
+	for _, record := range records {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if record.NextAttemptAt.After(now) {
+			continue
+		}
+		if err := p.process(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+func (p *CallbackProcessor) process(ctx context.Context, record CallbackRecord) error {
+	c := record.Callback
+	err := p.Handler(ctx, &c)
+
+	record.Attempts++
+	if err == nil {
+		record.Status = CallbackProcessed
+		record.LastError = ""
+		record.ProcessedAt = time.Now()
+	} else {
+		record.LastError = err.Error()
+		if record.Attempts >= p.maxAttempts() {
+			record.Status = CallbackFailed
+		} else {
+			record.NextAttemptAt = time.Now().Add(p.retryDelay(record.Attempts))
+		}
+	}
+	if saveErr := p.Store.Save(ctx, record); saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// Failed returns the callbacks that were set aside after failing MaxAttempts
+// times, oldest first.
+func (p *CallbackProcessor) Failed(ctx context.Context) ([]CallbackRecord, error) {
+	return p.Store.List(ctx, CallbackFailed)
+}
+
+// Replay queues the callback with the given key to be handled again by Run,
+// with a fresh set of attempts. Any callback can be replayed, including one
+// that was processed successfully.
+// ErrCallbackNotFound is returned if no callback with the given key was received.
+func (p *CallbackProcessor) Replay(ctx context.Context, key string) error {
+	record, err := p.Store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	record.Status = CallbackPending
+	record.Attempts = 0
+	record.NextAttemptAt = time.Now()
+	if err := p.Store.Save(ctx, *record); err != nil {
+		return err
+	}
+	p.notify()
+	return nil
+}
+
+// wakeChan returns the channel used to wake Run up, creating it on first use so
+// that processors built without NewCallbackProcessor are woken up too.
+func (p *CallbackProcessor) wakeChan() chan struct{} {
+	p.wakeOnce.Do(func() {
+		p.wake = make(chan struct{}, 1)
+	})
+	return p.wake
+}
+
+// notify wakes Run up without blocking.
+func (p *CallbackProcessor) notify() {
+	select {
+	case p.wakeChan() <- struct{}{}:
+	default:
+	}
+}
+
+func (p *CallbackProcessor) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return defaultCallbackMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+// retryDelay returns the delay before retrying a callback that failed the given
+// number of times: RetryBackoff doubled on every retry, up to MaxRetryBackoff.
+func (p *CallbackProcessor) retryDelay(attempts int) time.Duration {
+	delay, max := p.RetryBackoff, p.MaxRetryBackoff
+	if delay <= 0 {
+		delay = defaultCallbackRetryBackoff
+	}
+	if max <= 0 {
+		max = defaultCallbackMaxBackoff
+	}
+	for i := 1; i < attempts && delay < max; i++ {
+		if delay > max/2 {
+			return max
+		}
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
@@ -0,0 +1,205 @@
+package billplz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCallbackProcessorServeHTTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		signKey string
+		want    int
+	}{
+		{"valid", testXSignatureKey, testXSignatureKey, http.StatusOK},
+		{"invalid signature", testXSignatureKey, "other", http.StatusForbidden},
+		{"no key configured", "", "", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewCallbackProcessor(nil, tt.key, func(ctx context.Context, c *Callback) error { return nil })
+			values := testCallback().Values()
+			SignValues(tt.signKey, values)
+
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, newCallbackRequest(values))
+			if w.Code != tt.want {
+				t.Errorf("responded %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallbackProcessorRun(t *testing.T) {
+	handled := make(chan string, 10)
+	errs := make(chan error, 10)
+	p := &CallbackProcessor{
+		Store: NewMemoryCallbackStore(),
+		Handler: func(ctx context.Context, c *Callback) error {
+			handled <- c.ID
+			if c.ID == "failing" {
+				return errors.New("fulfilment failed")
+			}
+			return nil
+		},
+		Interval:     time.Hour,
+		RetryBackoff: time.Hour,
+		OnError:      func(err error) { errs <- err },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	receive := func(id string) {
+		c := testCallback()
+		c.ID = id
+		if added, err := p.Receive(ctx, c); !added || err != nil {
+			t.Fatalf("Receive(%s) = %v, %v", id, added, err)
+		}
+	}
+	wait := func(want string) {
+		select {
+		case id := <-handled:
+			if id != want {
+				t.Fatalf("handled %s, want %s", id, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was not handled without waiting for Interval", want)
+		}
+	}
+
+	receive("W_79pJDk")
+	wait("W_79pJDk")
+
+	receive("failing")
+	wait("failing")
+	select {
+	case err := <-errs:
+		if err.Error() != "fulfilment failed" {
+			t.Errorf("OnError got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnError was not called")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() = %v, want context.Canceled", err)
+	}
+}
+
+func TestCallbackProcessorNoHandler(t *testing.T) {
+	p := NewCallbackProcessor(nil, testXSignatureKey, nil)
+	if err := p.Run(context.Background()); err != ErrNoCallbackHandler {
+		t.Errorf("Run() = %v, want ErrNoCallbackHandler", err)
+	}
+	if err := p.ProcessPending(context.Background()); err != ErrNoCallbackHandler {
+		t.Errorf("ProcessPending() = %v, want ErrNoCallbackHandler", err)
+	}
+
+	values := testCallback().Values()
+	SignValues(testXSignatureKey, values)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, newCallbackRequest(values))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("responded %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestCallbackProcessorRetryDelay(t *testing.T) {
+	tests := []struct {
+		backoff  time.Duration
+		max      time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0, 1, time.Minute},
+		{0, 0, 3, 4 * time.Minute},
+		{0, 0, 100, 24 * time.Hour},
+		{time.Second, time.Minute, 6, 32 * time.Second},
+		{time.Second, time.Minute, 7, time.Minute},
+		{time.Second, time.Minute, 70, time.Minute},
+		{time.Hour, time.Minute, 1, time.Minute},
+		{1 << 62, 1<<63 - 1, 3, 1<<63 - 1},
+	}
+
+	for _, tt := range tests {
+		p := &CallbackProcessor{RetryBackoff: tt.backoff, MaxRetryBackoff: tt.max}
+		if got := p.retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) with backoff %v, max %v = %v, want %v", tt.attempts, tt.backoff, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestFileCallbackStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "callbacks.json")
+	s, err := NewFileCallbackStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := CallbackRecord{Key: "a", Status: CallbackPending}
+	if added, err := s.Add(ctx, record); !added || err != nil {
+		t.Fatalf("Add() = %v, %v", added, err)
+	}
+	if added, err := s.Add(ctx, record); added || err != nil {
+		t.Errorf("Add() of a duplicate = %v, %v, want false", added, err)
+	}
+	record.Status = CallbackProcessed
+	if err := s.Save(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileCallbackStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reloaded.Get(ctx, "a"); err != nil || got.Status != CallbackProcessed {
+		t.Errorf("Get() after reload = %+v, %v, want the processed record", got, err)
+	}
+}
+
+func TestFileCallbackStoreWriteFailure(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "callbacks.json")
+	s, err := NewFileCallbackStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := CallbackRecord{Key: "a", Status: CallbackPending}
+	if _, err := s.Add(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+
+	// A non-empty directory cannot be renamed over, so every write fails.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	record.Status = CallbackProcessed
+	if err := s.Save(ctx, record); err == nil {
+		t.Fatal("Save() succeeded, want the write to fail")
+	}
+	if got, err := s.Get(ctx, "a"); err != nil || got.Status != CallbackPending {
+		t.Errorf("Get() after a failed Save = %+v, %v, want the record unchanged", got, err)
+	}
+	if added, err := s.Add(ctx, CallbackRecord{Key: "b"}); added || err == nil {
+		t.Errorf("Add() = %v, %v, want the write to fail", added, err)
+	}
+	if _, err := s.Get(ctx, "b"); err != ErrCallbackNotFound {
+		t.Errorf("Get() after a failed Add = %v, want ErrCallbackNotFound", err)
+	}
+}
@@ -0,0 +1,330 @@
+package billplz
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the X-Signature parameter in callbacks and redirects.
+const (
+	xSignatureField         = "x_signature"
+	redirectXSignatureField = "billplz[x_signature]"
+)
+
+// Callback represents the payment details that Billplz sends for a bill, either
+// POSTed to the bill's CallbackURL, or appended to its RedirectURL as query
+// parameters. Redirects only carry ID, Paid, PaidAt, TransactionID,
+// TransactionStatus and XSignature.
+type Callback struct {
+	ID                string `json:"id,omitempty"`
+	CollectionID      string `json:"collection_id,omitempty"`
+	Paid              bool   `json:"paid"`
+	State             string `json:"state,omitempty"`
+	Amount            uint   `json:"amount,omitempty"`
+	PaidAmount        uint   `json:"paid_amount,omitempty"`
+	DueAt             string `json:"due_at,omitempty"`
+	Email             string `json:"email,omitempty"`
+	Mobile            string `json:"mobile,omitempty"`
+	Name              string `json:"name,omitempty"`
+	URL               string `json:"url,omitempty"`
+	PaidAt            string `json:"paid_at,omitempty"`
+	TransactionID     string `json:"transaction_id,omitempty"`
+	TransactionStatus string `json:"transaction_status,omitempty"`
+	XSignature        string `json:"x_signature,omitempty"`
+}
+
+// ParseCallback parses and verifies the callback POSTed by Billplz in the given
+// request, using the X-Signature key of the Billplz account.
+// An error will be returned if the key is empty, if the form cannot be parsed,
+// if the signature is invalid, or if a field has an invalid value.
+func ParseCallback(r *http.Request, key string) (*Callback, error) {
+	keys, err := NewSignatureKeySet(key)
+	if err != nil {
+		return nil, err
+	}
+	c, _, err := keys.ParseCallback(r)
+	return c, err
+}
+
+// ParseRedirect parses and verifies the payment details appended by Billplz to
+// the redirect URL of the given request, using the X-Signature key of the
+// Billplz account.
+// An error will be returned if the key is empty, if the signature is invalid,
+// or if a field has an invalid value.
+func ParseRedirect(r *http.Request, key string) (*Callback, error) {
+	keys, err := NewSignatureKeySet(key)
+	if err != nil {
+		return nil, err
+	}
+	c, _, err := keys.ParseRedirect(r)
+	return c, err
+}
+
+func parseCallbackValues(values url.Values, prefix string) (*Callback, error) {
+	get := func(name string) string {
+		if prefix != "" {
+			return values.Get(prefix + "[" + name + "]")
+		}
+		return values.Get(name)
+	}
+	c := &Callback{
+		ID:                get("id"),
+		CollectionID:      get("collection_id"),
+		State:             get("state"),
+		DueAt:             get("due_at"),
+		Email:             get("email"),
+		Mobile:            get("mobile"),
+		Name:              get("name"),
+		URL:               get("url"),
+		PaidAt:            get("paid_at"),
+		TransactionID:     get("transaction_id"),
+		TransactionStatus: get("transaction_status"),
+		XSignature:        get(xSignatureField),
+	}
+
+	var err error
+	if c.Paid, err = strconv.ParseBool(get("paid")); err != nil {
+		return nil, fmt.Errorf("billplz: invalid callback field paid: %q", get("paid"))
+	}
+	if c.Amount, err = parseCallbackAmount(get("amount")); err != nil {
+		return nil, fmt.Errorf("billplz: invalid callback field amount: %q", get("amount"))
+	}
+	if c.PaidAmount, err = parseCallbackAmount(get("paid_amount")); err != nil {
+		return nil, fmt.Errorf("billplz: invalid callback field paid_amount: %q", get("paid_amount"))
+	}
+	return c, nil
+}
+
+func parseCallbackAmount(s string) (uint, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 0)
+	return uint(n), err
+}
+
+// Values returns the callback as the form values POSTed by Billplz. The
+// x_signature field is included if XSignature is set.
+func (c *Callback) Values() url.Values {
+	values := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	set("id", c.ID)
+	set("collection_id", c.CollectionID)
+	values.Set("paid", strconv.FormatBool(c.Paid))
+	set("state", c.State)
+	values.Set("amount", strconv.FormatUint(uint64(c.Amount), 10))
+	values.Set("paid_amount", strconv.FormatUint(uint64(c.PaidAmount), 10))
+	set("due_at", c.DueAt)
+	set("email", c.Email)
+	set("mobile", c.Mobile)
+	set("name", c.Name)
+	set("url", c.URL)
+	set("paid_at", c.PaidAt)
+	set("transaction_id", c.TransactionID)
+	set("transaction_status", c.TransactionStatus)
+	set(xSignatureField, c.XSignature)
+	return values
+}
+
+// RedirectValues returns the query parameters appended by Billplz to a bill's
+// redirect URL. The billplz[x_signature] parameter is included if XSignature is
+// set. Note that the signature of a redirect differs from the signature of the
+// callback, as it covers fewer fields.
+func (c *Callback) RedirectValues() url.Values {
+	values := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			values.Set("billplz["+name+"]", value)
+		}
+	}
+	set("id", c.ID)
+	set("paid", strconv.FormatBool(c.Paid))
+	set("paid_at", c.PaidAt)
+	set("transaction_id", c.TransactionID)
+	set("transaction_status", c.TransactionStatus)
+	set(xSignatureField, c.XSignature)
+	return values
+}
+
+// Sign sets the X-Signature of the callback's form values, computed with the
+// given key.
+func (c *Callback) Sign(key string) {
+	c.XSignature = ""
+	c.XSignature = ComputeXSignature(key, c.Values())
+}
+
+// SignValues sets the X-Signature of a set of callback form values or redirect
+// query parameters, computed with the given key.
+func SignValues(key string, values url.Values) {
+	field := xSignatureField
+	if IsRedirect(values) {
+		field = redirectXSignatureField
+	}
+	values.Del(field)
+	values.Set(field, ComputeXSignature(key, values))
+}
+
+// ComputeXSignature computes the X-Signature of a set of callback form values or
+// redirect query parameters with the given key. Every field except the
+// signature itself is concatenated with its value, with the brackets of
+// redirect parameters removed. The resulting strings are sorted
+// case-insensitively, joined with "|" and signed with HMAC-SHA256.
+// Query parameters of a redirect that are not in the billplz[...] form belong to
+// the redirect URL itself, and are not signed.
+func ComputeXSignature(key string, values url.Values) string {
+	redirect := IsRedirect(values)
+	parts := make([]string, 0, len(values))
+	for name, vs := range values {
+		if name == xSignatureField || name == redirectXSignatureField {
+			continue
+		}
+		if redirect && !strings.HasPrefix(name, "billplz[") {
+			continue
+		}
+		name = strings.NewReplacer("[", "", "]", "").Replace(name)
+		for _, v := range vs {
+			parts = append(parts, name+v)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return strings.ToLower(parts[i]) < strings.ToLower(parts[j])
+	})
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyXSignature checks the X-Signature of a set of callback form values or
+// redirect query parameters against the given key.
+// ErrNoSignatureKey is returned if the key is empty, and ErrInvalidSignature if
+// the signature is missing or does not match.
+func VerifyXSignature(key string, values url.Values) error {
+	if key == "" {
+		return ErrNoSignatureKey
+	}
+	signature := values.Get(xSignatureField)
+	if signature == "" {
+		signature = values.Get(redirectXSignatureField)
+	}
+	if signature == "" {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(ComputeXSignature(key, values))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// IsRedirect reports whether values are the query parameters appended by Billplz
+// to a redirect URL, in the billplz[...] form, rather than callback form values.
+func IsRedirect(values url.Values) bool {
+	_, ok := values["billplz[id]"]
+	return ok
+}
+
+// SignatureKey is an X-Signature key of a Billplz account.
+type SignatureKey struct {
+	// ID identifies the key in logs and records, without revealing it, such
+	// as "2019-05".
+	ID string
+
+	Key string
+
+	// ExpiresAt is the time after which a previous key is no longer accepted.
+	// A zero ExpiresAt never expires.
+	ExpiresAt time.Time
+}
+
+// SignatureKeySet holds the X-Signature keys accepted while a key is rotated in
+// the Billplz dashboard. Signatures are verified against the current key, then
+// against every previous key that has not expired. Outbound signatures are
+// always computed with the current key.
+type SignatureKeySet struct {
+	Current  SignatureKey
+	Previous []SignatureKey
+}
+
+// NewSignatureKeySet instantiates and returns a SignatureKeySet with the given
+// current key and no previous keys.
+// ErrNoSignatureKey is returned if the key is empty.
+func NewSignatureKeySet(key string) (*SignatureKeySet, error) {
+	if key == "" {
+		return nil, ErrNoSignatureKey
+	}
+	return &SignatureKeySet{Current: SignatureKey{Key: key}}, nil
+}
+
+// Verify checks the X-Signature of a set of callback form values or redirect
+// query parameters against the keys of the set, and returns the key that
+// matched.
+// ErrNoSignatureKey is returned if the current key is empty, and
+// ErrInvalidSignature if the signature is missing, or matches none of the
+// accepted keys. Empty previous keys are ignored.
+func (s *SignatureKeySet) Verify(values url.Values) (*SignatureKey, error) {
+	if s.Current.Key == "" {
+		return nil, ErrNoSignatureKey
+	}
+	if VerifyXSignature(s.Current.Key, values) == nil {
+		return &s.Current, nil
+	}
+	now := time.Now()
+	for i, key := range s.Previous {
+		if key.Key == "" || (!key.ExpiresAt.IsZero() && now.After(key.ExpiresAt)) {
+			continue
+		}
+		if VerifyXSignature(key.Key, values) == nil {
+			return &s.Previous[i], nil
+		}
+	}
+	return nil, ErrInvalidSignature
+}
+
+// Sign sets the X-Signature of a set of callback form values or redirect query
+// parameters, computed with the current key.
+func (s *SignatureKeySet) Sign(values url.Values) {
+	SignValues(s.Current.Key, values)
+}
+
+// ParseCallback parses the callback POSTed by Billplz in the given request,
+// verifies it against the keys of the set, and returns the key that matched.
+// An error will be returned if the current key is empty, if the form cannot be
+// parsed, if the signature is invalid, or if a field has an invalid value.
+func (s *SignatureKeySet) ParseCallback(r *http.Request) (*Callback, *SignatureKey, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, err
+	}
+	key, err := s.Verify(r.PostForm)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := parseCallbackValues(r.PostForm, "")
+	return c, key, err
+}
+
+// ParseRedirect parses the payment details appended by Billplz to the redirect
+// URL of the given request, verifies them against the keys of the set, and
+// returns the key that matched.
+// An error will be returned if the current key is empty, if the signature is
+// invalid, or if a field has an invalid value.
+func (s *SignatureKeySet) ParseRedirect(r *http.Request) (*Callback, *SignatureKey, error) {
+	values := r.URL.Query()
+	key, err := s.Verify(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := parseCallbackValues(values, "billplz")
+	return c, key, err
+}
@@ -0,0 +1,156 @@
+package billplz
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testXSignatureKey = "S-0Sq67GFD9Y5iXmi5iXMKsA"
+
+func testCallback() *Callback {
+	return &Callback{
+		ID:           "W_79pJDk",
+		CollectionID: "599",
+		Paid:         true,
+		State:        "paid",
+		Amount:       200,
+		PaidAmount:   200,
+		Name:         "Michael Yap",
+		Email:        "api@billplz.com",
+		URL:          "http://www.billplz.com/bills/W_79pJDk",
+		PaidAt:       "2015-03-09 16:23:59 +0800",
+	}
+}
+
+func newCallbackRequest(values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestParseCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		signKey string
+		key     string
+		tamper  bool
+		wantErr error
+	}{
+		{"valid", testXSignatureKey, testXSignatureKey, false, nil},
+		{"wrong key", "other", testXSignatureKey, false, ErrInvalidSignature},
+		{"tampered", testXSignatureKey, testXSignatureKey, true, ErrInvalidSignature},
+		{"empty key", "", "", false, ErrNoSignatureKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := testCallback().Values()
+			SignValues(tt.signKey, values)
+			if tt.tamper {
+				values.Set("amount", "20000")
+			}
+
+			c, err := ParseCallback(newCallbackRequest(values), tt.key)
+			if err != tt.wantErr {
+				t.Fatalf("ParseCallback() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (c.ID != "W_79pJDk" || !c.Paid || c.Amount != 200) {
+				t.Errorf("ParseCallback() = %+v", c)
+			}
+		})
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		tamper  string
+		wantErr error
+	}{
+		{"valid", testXSignatureKey, "", nil},
+		{"merchant parameter", testXSignatureKey, "order", nil},
+		{"tampered", testXSignatureKey, "billplz[paid]", ErrInvalidSignature},
+		{"empty key", "", "", ErrNoSignatureKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := testCallback().RedirectValues()
+			SignValues(testXSignatureKey, values)
+			if tt.tamper != "" {
+				values.Set(tt.tamper, "false")
+			}
+			r := httptest.NewRequest(http.MethodGet, "/return?"+values.Encode(), nil)
+
+			if _, err := ParseRedirect(r, tt.key); err != tt.wantErr {
+				t.Errorf("ParseRedirect() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsRedirect(t *testing.T) {
+	if IsRedirect(testCallback().Values()) {
+		t.Error("IsRedirect() of callback values = true")
+	}
+	if !IsRedirect(testCallback().RedirectValues()) {
+		t.Error("IsRedirect() of redirect values = false")
+	}
+}
+
+func TestVerifyXSignatureEmptyKey(t *testing.T) {
+	values := testCallback().Values()
+	SignValues("", values)
+	if err := VerifyXSignature("", values); err != ErrNoSignatureKey {
+		t.Errorf("VerifyXSignature() = %v, want ErrNoSignatureKey", err)
+	}
+	if _, err := NewSignatureKeySet(""); err != ErrNoSignatureKey {
+		t.Errorf("NewSignatureKeySet() = %v, want ErrNoSignatureKey", err)
+	}
+}
+
+func TestSignatureKeySetVerify(t *testing.T) {
+	keys := &SignatureKeySet{
+		Current: SignatureKey{ID: "new", Key: "NEW_KEY"},
+		Previous: []SignatureKey{
+			{ID: "empty"},
+			{ID: "expired", Key: "EXPIRED_KEY", ExpiresAt: time.Now().Add(-time.Hour)},
+			{ID: "old", Key: "OLD_KEY", ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}
+	tests := []struct {
+		signKey string
+		wantID  string
+		wantErr error
+	}{
+		{"NEW_KEY", "new", nil},
+		{"OLD_KEY", "old", nil},
+		{"EXPIRED_KEY", "", ErrInvalidSignature},
+		{"", "", ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		values := testCallback().Values()
+		SignValues(tt.signKey, values)
+		key, err := keys.Verify(values)
+		if err != tt.wantErr {
+			t.Errorf("signed with %q: Verify() error = %v, want %v", tt.signKey, err, tt.wantErr)
+			continue
+		}
+		if err == nil && key.ID != tt.wantID {
+			t.Errorf("signed with %q: Verify() matched %q, want %q", tt.signKey, key.ID, tt.wantID)
+		}
+	}
+
+	empty := &SignatureKeySet{}
+	values := testCallback().Values()
+	SignValues("", values)
+	if _, err := empty.Verify(values); err != ErrNoSignatureKey {
+		t.Errorf("Verify() with no current key = %v, want ErrNoSignatureKey", err)
+	}
+}
@@ -0,0 +1,253 @@
+package billplz
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TenantConfig holds the Billplz account settings of a tenant of a ClientPool,
+// such as a merchant of a marketplace.
+type TenantConfig struct {
+	APIKey  string
+	Sandbox bool
+
+	// XSignatureKey is used to verify the tenant's callbacks if SignatureKeys
+	// is nil. Callbacks of a tenant without any key are rejected.
+	XSignatureKey string
+
+	// SignatureKeys, if set, holds the keys accepted while the tenant's
+	// X-Signature key is rotated.
+	SignatureKeys *SignatureKeySet
+
+	// CollectionIDs lists the collections owned by the tenant. It is used by
+	// MapTenantConfigProvider to route callbacks.
+	CollectionIDs []string
+}
+
+func (c *TenantConfig) signatureKeys() *SignatureKeySet {
+	if c.SignatureKeys != nil {
+		return c.SignatureKeys
+	}
+	return &SignatureKeySet{Current: SignatureKey{Key: c.XSignatureKey}}
+}
+
+// TenantConfigProvider looks up the configuration of the tenants of a
+// ClientPool.
+type TenantConfigProvider interface {
+	// TenantConfig returns the configuration of the tenant with the given ID,
+	// or ErrTenantNotFound.
+	TenantConfig(ctx context.Context, tenantID string) (*TenantConfig, error)
+
+	// TenantForCollection returns the ID of the tenant owning the collection
+	// with the given ID, or ErrTenantNotFound.
+	TenantForCollection(ctx context.Context, collectionID string) (string, error)
+}
+
+// MapTenantConfigProvider is a TenantConfigProvider backed by a map of tenant
+// IDs to their configuration. The map must not be modified while in use.
+type MapTenantConfigProvider map[string]TenantConfig
+
+// TenantConfig implements TenantConfigProvider.
+func (m MapTenantConfigProvider) TenantConfig(ctx context.Context, tenantID string) (*TenantConfig, error) {
+	config, ok := m[tenantID]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+	return &config, nil
+}
+
+// TenantForCollection implements TenantConfigProvider.
+func (m MapTenantConfigProvider) TenantForCollection(ctx context.Context, collectionID string) (string, error) {
+	for tenantID, config := range m {
+		for _, id := range config.CollectionIDs {
+			if id == collectionID {
+				return tenantID, nil
+			}
+		}
+	}
+	return "", ErrTenantNotFound
+}
+
+// ClientPool manages the Clients of many tenants, each with their own Billplz
+// account. Clients are built lazily from the tenant's configuration, and kept
+// until Invalidate is called. All clients share the pool's http.Client, and
+// clients using the same API key share a rate limiter.
+// It is safe for concurrent use.
+type ClientPool struct {
+	Provider TenantConfigProvider
+
+	// HTTPClient is shared by all clients. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// RateLimit is the minimum time between two requests made with the same
+	// API key. Requests are not rate limited if RateLimit is not positive.
+	RateLimit time.Duration
+
+	// Configure, if set, is called on every new Client, such as to set its
+	// MaxRetries or Logger.
+	Configure func(tenantID string, c *Client)
+
+	mu       sync.Mutex
+	tenants  map[string]*poolTenant
+	limiters map[string]RateLimiter
+}
+
+// poolTenant is a tenant's configuration and Client, as cached by a ClientPool.
+type poolTenant struct {
+	config *TenantConfig
+	client *Client
+}
+
+// NewClientPool instantiates and returns a new ClientPool reading tenant
+// configurations from the given provider.
+// If a http.Client is not supplied, the pool will use the default HTTP client.
+func NewClientPool(provider TenantConfigProvider, httpClient *http.Client) *ClientPool {
+	return &ClientPool{
+		Provider:   provider,
+		HTTPClient: httpClient,
+	}
+}
+
+// Client returns the Client of the tenant with the given ID, building it on
+// first use.
+// An error will be returned if the tenant's configuration cannot be found.
+func (p *ClientPool) Client(ctx context.Context, tenantID string) (*Client, error) {
+	t, err := p.tenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return t.client, nil
+}
+
+// Invalidate drops the Client and configuration of the tenant with the given
+// ID, so they are rebuilt from the provider on next use, such as after the
+// tenant changed their API key. The rate limiter of the tenant's API key is
+// dropped too, unless another tenant uses the same key.
+func (p *ClientPool) Invalidate(tenantID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.tenants[tenantID]
+	if !ok {
+		return
+	}
+	delete(p.tenants, tenantID)
+	for _, other := range p.tenants {
+		if other.config.APIKey == t.config.APIKey {
+			return
+		}
+	}
+	delete(p.limiters, t.config.APIKey)
+}
+
+func (p *ClientPool) tenant(ctx context.Context, tenantID string) (*poolTenant, error) {
+	p.mu.Lock()
+	t, ok := p.tenants[tenantID]
+	p.mu.Unlock()
+	if ok {
+		return t, nil
+	}
+
+	config, err := p.Provider.TenantConfig(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(p.HTTPClient, config.APIKey, config.Sandbox)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.tenants[tenantID]; ok {
+		return t, nil
+	}
+	if p.RateLimit > 0 {
+		c.RateLimiter = p.limiter(config.APIKey)
+	}
+	if p.Configure != nil {
+		p.Configure(tenantID, c)
+	}
+	t = &poolTenant{config: config, client: c}
+	if p.tenants == nil {
+		p.tenants = make(map[string]*poolTenant)
+	}
+	p.tenants[tenantID] = t
+	return t, nil
+}
+
+// limiter returns the rate limiter shared by the clients using the given API
+// key. It must be called with p.mu held.
+func (p *ClientPool) limiter(apiKey string) RateLimiter {
+	if l, ok := p.limiters[apiKey]; ok {
+		return l
+	}
+	if p.limiters == nil {
+		p.limiters = make(map[string]RateLimiter)
+	}
+	l := NewRateLimiter(p.RateLimit)
+	p.limiters[apiKey] = l
+	return l
+}
+
+// ParseCallback finds the tenant owning the collection of the callback POSTed
+// in the given request, and parses and verifies the callback with the tenant's
+// X-Signature keys.
+// ErrTenantNotFound is returned if no tenant owns the collection,
+// ErrNoSignatureKey if the tenant has no X-Signature key, and
+// ErrInvalidSignature if the signature does not match the tenant's keys.
+func (p *ClientPool) ParseCallback(r *http.Request) (string, *Callback, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", nil, err
+	}
+	ctx := r.Context()
+	tenantID, err := p.Provider.TenantForCollection(ctx, r.PostForm.Get("collection_id"))
+	if err != nil {
+		return "", nil, err
+	}
+	t, err := p.tenant(ctx, tenantID)
+	if err != nil {
+		return "", nil, err
+	}
+	c, _, err := t.config.signatureKeys().ParseCallback(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return tenantID, c, nil
+}
+
+// CallbackHandler returns an http.Handler that routes the callbacks of all
+// tenants to handle, after verifying them with ParseCallback. Callbacks of
+// unknown collections are rejected with 404 Not Found, callbacks with an
+// invalid signature with 403 Forbidden, and callbacks of tenants without an
+// X-Signature key or that handle fails with 500 Internal Server Error, so that
+// Billplz retries them.
+func (p *ClientPool) CallbackHandler(handle func(ctx context.Context, tenantID string, c *Callback) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		tenantID, c, err := p.ParseCallback(r)
+		switch {
+		case err == ErrTenantNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err == ErrInvalidSignature:
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err == ErrNoSignatureKey:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := handle(r.Context(), tenantID, c); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
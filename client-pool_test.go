@@ -0,0 +1,90 @@
+package billplz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientPoolCallbackHandler(t *testing.T) {
+	pool := NewClientPool(MapTenantConfigProvider{
+		"t1": {APIKey: "KEY_1", Sandbox: true, XSignatureKey: testXSignatureKey, CollectionIDs: []string{"599"}},
+		"t2": {APIKey: "KEY_2", Sandbox: true, CollectionIDs: []string{"600"}},
+	}, nil)
+
+	tests := []struct {
+		name         string
+		collectionID string
+		signKey      string
+		want         int
+		wantTenant   string
+	}{
+		{"routed", "599", testXSignatureKey, http.StatusOK, "t1"},
+		{"invalid signature", "599", "other", http.StatusForbidden, ""},
+		{"tenant without key", "600", "", http.StatusInternalServerError, ""},
+		{"unknown collection", "601", testXSignatureKey, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tenant string
+			handler := pool.CallbackHandler(func(ctx context.Context, tenantID string, c *Callback) error {
+				tenant = tenantID
+				return nil
+			})
+			c := testCallback()
+			c.CollectionID = tt.collectionID
+			values := c.Values()
+			SignValues(tt.signKey, values)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, newCallbackRequest(values))
+			if w.Code != tt.want {
+				t.Errorf("responded %d, want %d", w.Code, tt.want)
+			}
+			if tenant != tt.wantTenant {
+				t.Errorf("handled for tenant %q, want %q", tenant, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestClientPoolInvalidate(t *testing.T) {
+	pool := NewClientPool(MapTenantConfigProvider{
+		"t1": {APIKey: "SHARED_KEY"},
+		"t2": {APIKey: "SHARED_KEY"},
+	}, nil)
+	pool.RateLimit = time.Second
+	ctx := context.Background()
+
+	c1, err := pool.Client(ctx, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := pool.Client(ctx, "t2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1.RateLimiter != c2.RateLimiter {
+		t.Error("clients with the same API key do not share a rate limiter")
+	}
+
+	pool.Invalidate("t1")
+	if _, ok := pool.limiters["SHARED_KEY"]; !ok {
+		t.Error("limiter dropped while another tenant uses the key")
+	}
+	pool.Invalidate("t2")
+	if len(pool.limiters) != 0 {
+		t.Errorf("limiters of invalidated tenants are kept: %v", pool.limiters)
+	}
+
+	c3, err := pool.Client(ctx, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3 == c1 {
+		t.Error("invalidated client was not rebuilt")
+	}
+}
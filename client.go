@@ -3,11 +3,18 @@ package billplz
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ozzo/ozzo-validation"
 )
 
 // Client represents the HTTP client that interacts with the Billplz API. The
@@ -16,12 +23,91 @@ type Client struct {
 	baseURL    *url.URL
 	httpClient *http.Client
 
+	// APIKey authenticates requests if Credentials is nil.
 	APIKey string
+
+	// Credentials, if set, supplies the API key before every request, in place
+	// of APIKey.
+	Credentials CredentialsProvider
+
+	// Concurrency is the maximum number of requests made at the same time by
+	// functions that fan out into several requests, such as
+	// Client.GetBankAccountIndex. Defaults to 4 if not positive.
+	Concurrency int
+
+	// StrictDecoding causes requests to fail with an *UnknownFieldsError if the
+	// response contains fields that are not modelled by the package. It is
+	// meant for tests that detect changes to the API's responses.
+	StrictDecoding bool
+
+	// MaxRetries is the number of times a request is retried after a network
+	// error, a 429 response or a 5xx response. Only GET, PUT and DELETE requests
+	// are retried, so that POST requests never create duplicate resources.
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, doubled on every
+	// following retry. Defaults to 500 milliseconds.
+	RetryBackoff time.Duration
+
+	// RateLimiter, if set, is waited on before every request.
+	RateLimiter RateLimiter
+
+	// Logger, if set, receives a line for every request made. The API key is
+	// never logged.
+	Logger Logger
+
+	// PingOtherEnvironment causes Ping to retry a rejected API key against the
+	// other environment, to tell a key for the wrong environment from an
+	// invalid key. It is off by default, as the key is then sent to the other
+	// environment, such as a production key to the sandbox.
+	PingOtherEnvironment bool
+
+	// ValidateSplitPayments causes CreateBill to retrieve the bill's
+	// collection, through Cache if set, and check the bill's amount against
+	// the collection's split payment before creating the bill. Otherwise, use
+	// SplitPayment.PreviewSplit to check amounts before calling CreateBill.
+	ValidateSplitPayments bool
+
+	// AllowUnknownPaymentMethods causes UpdatePaymentMethods and
+	// EnsurePaymentMethods to accept well-formed payment method codes that the
+	// package does not model, such as ones added to the API after the package.
+	// Otherwise, such codes are rejected with ErrUnknownPaymentMethod, so that
+	// typos are caught.
+	AllowUnknownPaymentMethods bool
+
+	// Cache, if set, caches the results of GetCollection, GetOpenCollection
+	// and GetPaymentMethodIndex. Cached values are removed when the client
+	// changes the resource, such as with ActivateCollection.
+	// Keys are scoped to the client's endpoint and a hash of its API key, so a
+	// Cache can be shared by clients of different accounts, or of the sandbox
+	// and production. Rotating the API key starts from an empty cache.
+	Cache Cache
+
+	// CacheTTL sets how long each kind of resource is cached.
+	CacheTTL CacheTTL
+
+	flights *flightGroup
+}
+
+// Logger is the interface used by Client to log requests. It is satisfied by
+// *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
 }
 
+// APIVersion identifies a version of the Billplz REST API.
+type APIVersion string
+
+// Versions of the Billplz REST API. The package's own functions use APIVersion3.
+const (
+	APIVersion3 APIVersion = "v3"
+	APIVersion4 APIVersion = "v4"
+)
+
 // NewClient instantiates and returns a new Client.
 // If a http.Client is not supplied, the function will use the default HTTP client.
-// An API key must be provided for the client to authenticate with the API.
+// An API key must be provided for the client to authenticate with the API,
+// unless the Credentials field is set on the returned client.
 // The sandbox boolean value determines whether the client will communicate with
 // the sandbox endpoint or the production endpoint.
 func NewClient(httpClient *http.Client, apiKey string, sandbox bool) (*Client, error) {
@@ -32,13 +118,14 @@ func NewClient(httpClient *http.Client, apiKey string, sandbox bool) (*Client, e
 	c := &Client{
 		httpClient: httpClient,
 		APIKey:     apiKey,
+		flights:    &flightGroup{},
 	}
 
 	var err error
 	if sandbox {
 		c.baseURL, err = url.Parse(endpointStaging)
 	} else {
-		c.baseURL, err = url.Parse(endpointProdV3)
+		c.baseURL, err = url.Parse(endpointProd)
 	}
 
 	return c, err
@@ -51,7 +138,7 @@ func (c *Client) CreateCollection(collection Collection) (*Collection, error) {
 	if collection.SplitPayment == nil {
 		collection.SplitPayment = &SplitPayment{}
 	}
-	err := collection.validate()
+	err := collection.Validate()
 	if err != nil {
 		return nil, err
 	}
@@ -70,17 +157,37 @@ func (c *Client) CreateCollection(collection Collection) (*Collection, error) {
 // An error will be returned if the collection is not found, or if
 // the HTTP request fails.
 func (c *Client) GetCollection(id string) (*Collection, error) {
+	ctx := context.Background()
+	ttl := cacheTTL(c.CacheTTL.Collection)
+	if !c.caches(ttl) {
+		return c.getCollection(ctx, id)
+	}
+
+	var result Collection
+	err := c.cached(ctx, collectionCacheKey(id), ttl, &result, func(ctx context.Context) (interface{}, error) {
+		return c.getCollection(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) getCollection(ctx context.Context, id string) (*Collection, error) {
 	req, err := c.newRequest(http.MethodGet, "/collections/"+id, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var result Collection
-	res, err := c.do(req, &result)
-	if res.StatusCode == 404 {
+	res, err := c.do(req.WithContext(ctx), &result)
+	if res != nil && res.StatusCode == 404 {
 		return nil, ErrCollectionNotFound
 	}
-	return &result, err
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
 // GetCollectionIndex retrieves a set of collections. Up to 15 collections
@@ -123,7 +230,7 @@ func (c *Client) CreateOpenCollection(o OpenCollection) (*OpenCollection, error)
 	if o.SplitPayment == nil {
 		o.SplitPayment = &SplitPayment{}
 	}
-	err := o.validate()
+	err := o.Validate()
 	if err != nil {
 		return nil, err
 	}
@@ -142,17 +249,37 @@ func (c *Client) CreateOpenCollection(o OpenCollection) (*OpenCollection, error)
 // An error will be returned if the open collection is not found, or if
 // the HTTP request fails.
 func (c *Client) GetOpenCollection(id string) (*OpenCollection, error) {
+	ctx := context.Background()
+	ttl := cacheTTL(c.CacheTTL.OpenCollection)
+	if !c.caches(ttl) {
+		return c.getOpenCollection(ctx, id)
+	}
+
+	var result OpenCollection
+	err := c.cached(ctx, openCollectionCacheKey(id), ttl, &result, func(ctx context.Context) (interface{}, error) {
+		return c.getOpenCollection(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) getOpenCollection(ctx context.Context, id string) (*OpenCollection, error) {
 	req, err := c.newRequest(http.MethodGet, "/open_collections/"+id, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var result OpenCollection
-	res, err := c.do(req, &result)
-	if res.StatusCode == 404 {
+	res, err := c.do(req.WithContext(ctx), &result)
+	if res != nil && res.StatusCode == 404 {
 		return nil, ErrCollectionNotFound
 	}
-	return &result, err
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
 // GetOpenCollectionIndex retrieves a set of open collections. Up to 15
@@ -197,11 +324,12 @@ func (c *Client) DeactivateCollection(id string) error {
 		return err
 	}
 
-	res, err := c.do(req, struct{}{})
-	if res.StatusCode == http.StatusUnprocessableEntity {
+	res, err := c.do(req, nil)
+	c.invalidate(collectionCacheKey(id), openCollectionCacheKey(id))
+	if res != nil && res.StatusCode == http.StatusUnprocessableEntity {
 		return ErrCannotDeactivateCollection
 	}
-	return nil
+	return err
 }
 
 // ActivateCollection activates a collection with the given ID.
@@ -213,21 +341,30 @@ func (c *Client) ActivateCollection(id string) error {
 		return err
 	}
 
-	res, err := c.do(req, struct{}{})
-	if res.StatusCode == http.StatusUnprocessableEntity {
+	res, err := c.do(req, nil)
+	c.invalidate(collectionCacheKey(id), openCollectionCacheKey(id))
+	if res != nil && res.StatusCode == http.StatusUnprocessableEntity {
 		return ErrCannotActivateCollection
 	}
-	return nil
+	return err
 }
 
-// CreateBill creates a new bill.
+// CreateBill creates a new bill. The bill's mobile number is sent in E.164 form.
+// If ValidateSplitPayments is set, the bill's amount is also checked against the
+// split payment of its collection.
 // An error will be returned if the supplied bill fails validation,
 // or if the HTTP request fails.
 func (c *Client) CreateBill(b Bill) (*Bill, error) {
-	err := b.validate()
+	err := b.Validate()
 	if err != nil {
 		return nil, err
 	}
+	if c.ValidateSplitPayments {
+		if err := c.validateBillSplit(b); err != nil {
+			return nil, err
+		}
+	}
+	b.normalize()
 
 	req, err := c.newRequest(http.MethodPost, "/bills", b)
 	if err != nil {
@@ -239,21 +376,41 @@ func (c *Client) CreateBill(b Bill) (*Bill, error) {
 	return &result, err
 }
 
+// validateBillSplit checks that the split payment of the bill's collection can
+// be applied to the bill's amount.
+func (c *Client) validateBillSplit(b Bill) error {
+	collection, err := c.GetCollection(b.CollectionID)
+	if err != nil {
+		return err
+	}
+	errs := validation.Errors{
+		"split_payment": collection.SplitPayment.ValidateAmount(b.Amount),
+	}
+	return newValidationError(errs.Filter())
+}
+
 // GetBill retrieves a single bill with the given ID.
 // An error will be returned if the bill is not found, or
 // if the HTTP request fails.
 func (c *Client) GetBill(id string) (*Bill, error) {
+	return c.getBill(context.Background(), id)
+}
+
+func (c *Client) getBill(ctx context.Context, id string) (*Bill, error) {
 	req, err := c.newRequest(http.MethodGet, "/bills/"+id, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var result Bill
-	res, err := c.do(req, &result)
-	if res.StatusCode == 404 {
+	res, err := c.do(req.WithContext(ctx), &result)
+	if res != nil && res.StatusCode == 404 {
 		return nil, ErrBillNotFound
 	}
-	return &result, err
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
 // DeleteBill deletes a bill with the given ID.
@@ -265,8 +422,8 @@ func (c *Client) DeleteBill(id string) error {
 		return err
 	}
 
-	res, err := c.do(req, &struct{}{})
-	if res.StatusCode == 404 {
+	res, err := c.do(req, nil)
+	if res != nil && res.StatusCode == 404 {
 		return ErrBillNotFound
 	}
 	return err
@@ -278,13 +435,20 @@ func (c *Client) DeleteBill(id string) error {
 // An error will be returned if the bank account is not found or if the
 // HTTP request fails.
 func (c *Client) CheckRegistration(accountNumber string) (bool, error) {
+	return c.checkRegistration(context.Background(), accountNumber)
+}
+
+func (c *Client) checkRegistration(ctx context.Context, accountNumber string) (bool, error) {
 	req, err := c.newRequest(http.MethodGet, "/check/bank_account_number/"+accountNumber, nil)
 	if err != nil {
 		return false, err
 	}
 
 	var result BankAccountCheckResponse
-	_, err = c.do(req, &result)
+	res, err := c.do(req.WithContext(ctx), &result)
+	if res != nil && res.StatusCode == 404 {
+		return false, ErrBankAccountNotFound
+	}
 	if err != nil {
 		return false, err
 	}
@@ -307,6 +471,10 @@ func (c *Client) CheckRegistration(accountNumber string) (bool, error) {
 // take the values "", "pending", "completed", or "failed", and will default to "".
 // An error will be returned if the HTTP request fails.
 func (c *Client) GetBillTransactions(id string, page int, status string) (*BillTransactions, error) {
+	return c.getBillTransactions(context.Background(), id, page, status)
+}
+
+func (c *Client) getBillTransactions(ctx context.Context, id string, page int, status string) (*BillTransactions, error) {
 	if page <= 0 {
 		page = 1
 	}
@@ -327,7 +495,7 @@ func (c *Client) GetBillTransactions(id string, page int, status string) (*BillT
 	req.URL.RawQuery = q.Encode()
 
 	var result BillTransactions
-	_, err = c.do(req, &result)
+	_, err = c.do(req.WithContext(ctx), &result)
 	return &result, err
 }
 
@@ -335,21 +503,47 @@ func (c *Client) GetBillTransactions(id string, page int, status string) (*BillT
 // enabled or disabled on a collection with the given ID.
 // An error will be returned if the HTTP request fails.
 func (c *Client) GetPaymentMethodIndex(id string) (*[]PaymentMethod, error) {
+	ctx := context.Background()
+	ttl := cacheTTL(c.CacheTTL.PaymentMethods)
+	if !c.caches(ttl) {
+		return c.getPaymentMethodIndex(ctx, id)
+	}
+
+	var result *[]PaymentMethod
+	err := c.cached(ctx, paymentMethodsCacheKey(id), ttl, &result, func(ctx context.Context) (interface{}, error) {
+		return c.getPaymentMethodIndex(ctx, id)
+	})
+	return result, err
+}
+
+func (c *Client) getPaymentMethodIndex(ctx context.Context, id string) (*[]PaymentMethod, error) {
 	req, err := c.newRequest(http.MethodGet, "/collections/"+id+"/payment_methods", nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var result PaymentMethodList
-	_, err = c.do(req, &result)
+	_, err = c.do(req.WithContext(ctx), &result)
 	return result.PaymentMethods, err
 }
 
 // UpdatePaymentMethods enables a set of payment methods on a collection with the
-// given ID.
-// The payment method codes are passed as a slice of strings.
-// An error will be returned if the HTTP request fails.
-func (c *Client) UpdatePaymentMethods(id string, codes []string) (*[]PaymentMethod, error) {
+// given ID. Payment methods that are not in the set are disabled.
+// An error will be returned if any of the codes is not supported by the package
+// (see Client.AllowUnknownPaymentMethods), or if the HTTP request fails.
+func (c *Client) UpdatePaymentMethods(id string, codes []PaymentMethodCode) (*[]PaymentMethod, error) {
+	return c.updatePaymentMethods(context.Background(), id, codes)
+}
+
+func (c *Client) updatePaymentMethods(ctx context.Context, id string, codes []PaymentMethodCode) (*[]PaymentMethod, error) {
+	err := validatePaymentMethodCodes(codes, c.AllowUnknownPaymentMethods)
+	if err != nil {
+		return nil, err
+	}
+	return c.putPaymentMethods(ctx, id, codes)
+}
+
+func (c *Client) putPaymentMethods(ctx context.Context, id string, codes []PaymentMethodCode) (*[]PaymentMethod, error) {
 	methods := []PaymentMethod{}
 	for _, element := range codes {
 		methods = append(methods, PaymentMethod{
@@ -367,35 +561,161 @@ func (c *Client) UpdatePaymentMethods(id string, codes []string) (*[]PaymentMeth
 	}
 
 	var result PaymentMethodList
-	_, err = c.do(req, &result)
+	_, err = c.do(req.WithContext(ctx), &result)
+	c.invalidate(paymentMethodsCacheKey(id))
 	return result.PaymentMethods, err
 }
 
+// EnsurePaymentMethods makes the set of payment methods enabled on a collection with
+// the given ID match the desired set. The current set is retrieved first, and an
+// update is only sent if the sets differ.
+// The returned PaymentMethodChanges lists the payment methods that were enabled or
+// disabled by the call.
+// Active payment methods that the package does not model, such as ones added to
+// the API after the package, are left enabled and listed in the Kept field of the
+// returned PaymentMethodChanges, unless Client.AllowUnknownPaymentMethods is set,
+// in which case they are disabled like any other method that is not desired.
+// An error will be returned if any of the desired codes is not supported by the
+// package, or if either HTTP request fails.
+func (c *Client) EnsurePaymentMethods(ctx context.Context, collectionID string, desired []PaymentMethodCode) (*PaymentMethodChanges, error) {
+	err := validatePaymentMethodCodes(desired, c.AllowUnknownPaymentMethods)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := c.getPaymentMethodIndex(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []PaymentMethodCode
+	if !c.AllowUnknownPaymentMethods {
+		kept = unknownPaymentMethods(current, desired)
+		desired = append(append([]PaymentMethodCode{}, desired...), kept...)
+	}
+	changes := diffPaymentMethods(current, desired)
+	changes.Kept = kept
+	if !changes.Changed() {
+		return changes, nil
+	}
+
+	_, err = c.putPaymentMethods(ctx, collectionID, desired)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
 // GetBankAccountIndex gets a set of bank accounts with the given account numbers.
+// It is like GetBankAccountIndexContext with a background context.
+func (c *Client) GetBankAccountIndex(accountNumbers []string) (*BankAccountList, error) {
+	return c.GetBankAccountIndexContext(context.Background(), accountNumbers)
+}
+
+// GetBankAccountIndexContext gets a set of bank accounts with the given account numbers.
+// The API accepts up to 10 account numbers per request, so the account numbers are
+// split into chunks of 10 that are fetched concurrently, up to the client's Concurrency
+// limit. The results are merged into a single list, and account numbers that were not
+// returned by the API are listed in the result's NotFound field. Spaces and dashes in
+// account numbers are ignored.
 // This function requires the Billplz 'ADMIN' setting to be turned on, and will return
 // an error if this condition is not met.
-// An error will also be returned if the HTTP request fails.
-func (c *Client) GetBankAccountIndex(accountNumbers []string) (*BankAccountList, error) {
+// An error will also be returned if any of the HTTP requests fail, in which case the
+// chunks not fetched yet are canceled, and the returned list holds the accounts of the
+// chunks that were fetched.
+func (c *Client) GetBankAccountIndexContext(ctx context.Context, accountNumbers []string) (*BankAccountList, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	normalized := make([]string, len(accountNumbers))
+	for i, accountNumber := range accountNumbers {
+		normalized[i] = normalizeAccountNumber(accountNumber)
+	}
+	chunks := chunkStrings(normalized, bankAccountIndexChunkSize)
+	results := make([]*BankAccountList, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, c.concurrency())
+	for i, chunk := range chunks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, chunk []string) {
+			defer wg.Done()
+			results[i], errs[i] = c.getBankAccountIndexChunk(ctx, chunk)
+			if errs[i] != nil {
+				cancel()
+			}
+			<-sem
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	accounts := []BankAccount{}
+	fetched := make(map[string]bool, len(normalized))
+	var failures []error
+	for i, result := range results {
+		if err := errs[i]; err != nil {
+			// Chunks canceled after another chunk failed are not failures
+			// of their own.
+			if parent.Err() != nil || !errors.Is(err, context.Canceled) {
+				failures = append(failures, err)
+			}
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		for _, accountNumber := range chunks[i] {
+			fetched[accountNumber] = true
+		}
+		if result.BankAccounts != nil {
+			accounts = append(accounts, *result.BankAccounts...)
+		}
+	}
+	if len(failures) == 0 && parent.Err() != nil {
+		failures = append(failures, parent.Err())
+	}
+
+	found := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		found[normalizeAccountNumber(account.AccountNumber)] = true
+	}
+	list := &BankAccountList{BankAccounts: &accounts}
+	for i, accountNumber := range accountNumbers {
+		if fetched[normalized[i]] && !found[normalized[i]] {
+			list.NotFound = append(list.NotFound, accountNumber)
+			found[normalized[i]] = true
+		}
+	}
+	return list, joinErrors(failures)
+}
+
+func (c *Client) getBankAccountIndexChunk(ctx context.Context, accountNumbers []string) (*BankAccountList, error) {
 	req, err := c.newRequest(http.MethodGet, "/bank_verification_services", nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var q = req.URL.Query()
-	for index, element := range accountNumbers {
-		if index > 9 {
-			break
-		}
+	for _, element := range accountNumbers {
 		q.Add("account_numbers[]", element)
 	}
 	req.URL.RawQuery = q.Encode()
 
 	var result BankAccountList
-	res, err := c.do(req, &result)
-	if res.StatusCode == 422 || res.StatusCode == 401 {
-		return nil, ErrAdminPrivilegeRequired
+	res, err := c.do(req.WithContext(ctx), &result)
+	if err != nil {
+		return nil, bankAccountError(res, err)
 	}
-	return &result, err
+	return &result, nil
 }
 
 // GetBankAccount gets a bank account with the given account number.
@@ -403,28 +723,36 @@ func (c *Client) GetBankAccountIndex(accountNumbers []string) (*BankAccountList,
 // an error if this condition is not met.
 // An error will also be returned if the HTTP request fails.
 func (c *Client) GetBankAccount(accountNumber string) (*BankAccount, error) {
+	return c.getBankAccount(context.Background(), accountNumber)
+}
+
+func (c *Client) getBankAccount(ctx context.Context, accountNumber string) (*BankAccount, error) {
 	req, err := c.newRequest(http.MethodGet, "/bank_verification_services/"+accountNumber, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var result BankAccount
-	res, err := c.do(req, &result)
-	if res.StatusCode == 422 {
-		return nil, ErrAdminPrivilegeRequired
+	res, err := c.do(req.WithContext(ctx), &result)
+	if err != nil {
+		return nil, bankAccountError(res, err)
 	}
-
-	return &result, err
+	return &result, nil
 }
 
 // CreateBankAccount creates a new bank account through the API's Bank Account
 // Direct Verification Service.
 // This function requires the Billplz 'ADMIN' setting to be turned on, and will return
-// an error if this condition is not met.
+// ErrAdminPrivilegeRequired if this condition is not met.
 // An error will also be returned if the supplied bank account fails validation,
-// or if the HTTP request fails.
+// or if the HTTP request fails. The error is a *ValidationError if the bank account
+// is rejected, either by BankAccount.Validate or by the API.
 func (c *Client) CreateBankAccount(b BankAccount) (*BankAccount, error) {
-	err := b.validate()
+	return c.createBankAccount(context.Background(), b)
+}
+
+func (c *Client) createBankAccount(ctx context.Context, b BankAccount) (*BankAccount, error) {
+	err := b.Validate()
 	if err != nil {
 		return nil, err
 	}
@@ -435,21 +763,81 @@ func (c *Client) CreateBankAccount(b BankAccount) (*BankAccount, error) {
 	}
 
 	var result BankAccount
-	res, err := c.do(req, &result)
-	if res.StatusCode == 422 || res.StatusCode == 401 {
-		return nil, ErrAdminPrivilegeRequired
+	res, err := c.do(req.WithContext(ctx), &result)
+	if err != nil {
+		return nil, bankAccountError(res, err)
 	}
-	return &result, err
+	return &result, nil
+}
+
+// bankAccountError maps the error of a request to the Bank Account Direct
+// Verification Service. The API rejects such requests with a 401 response, or
+// with a 422 response mentioning the 'ADMIN' setting, if the setting is not
+// enabled. Other 422 responses are left as a *ValidationError.
+func bankAccountError(res *http.Response, err error) error {
+	if res == nil {
+		return err
+	}
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		return ErrAdminPrivilegeRequired
+	case http.StatusUnprocessableEntity:
+		if verr, ok := err.(*ValidationError); ok {
+			for _, f := range verr.Fields {
+				if strings.Contains(strings.ToLower(f.Message), "admin") {
+					return ErrAdminPrivilegeRequired
+				}
+			}
+		}
+	}
+	return err
+}
+
+func (c *Client) concurrency() int {
+	if c.Concurrency <= 0 {
+		return defaultConcurrency
+	}
+	return c.Concurrency
+}
+
+// Do sends a request to an endpoint of version 3 of the Billplz API, for
+// endpoints that the package does not support yet. The path is relative to the
+// version's base URL, such as "/bills/8X0Iyzaw", and may include a query string.
+// The body, if not nil, is sent as JSON without the Extra fields of the resources
+// it holds, and the response body is decoded into out, if not nil.
+// Requests made with Do are authenticated, retried, rate limited and logged
+// like the package's own requests. A 401 response results in ErrUnauthorized,
+// a 422 response in a *ValidationError, and other error responses in an
+// *APIError.
+func (c *Client) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	return c.DoVersion(ctx, APIVersion3, method, path, body, out)
+}
+
+// DoVersion is like Do, but sends the request to the given version of the API.
+func (c *Client) DoVersion(ctx context.Context, version APIVersion, method, path string, body, out interface{}) error {
+	req, err := c.newVersionRequest(version, method, path, body)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(req.WithContext(ctx), out)
+	return err
 }
 
 func (c *Client) newRequest(method, path string, body interface{}) (*http.Request, error) {
-	u := c.baseURL
-	u.Path = u.Path + path
+	return c.newVersionRequest(APIVersion3, method, path, body)
+}
+
+func (c *Client) newVersionRequest(version APIVersion, method, path string, body interface{}) (*http.Request, error) {
+	u := *c.baseURL
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, u.RawQuery = path[:i], path[i+1:]
+	}
+	u.Path = u.Path + "/" + string(version) + path
 
 	var buf io.ReadWriter
 	if body != nil {
 		buf = new(bytes.Buffer)
-		err := json.NewEncoder(buf).Encode(body)
+		err := json.NewEncoder(buf).Encode(withoutExtra(body))
 		if err != nil {
 			return nil, err
 		}
@@ -462,16 +850,139 @@ func (c *Client) newRequest(method, path string, body interface{}) (*http.Reques
 		req.Header.Set("Content-Type", "application/json")
 	}
 	req.Header.Set("Accept", "application/json")
-	req.SetBasicAuth(c.APIKey, "")
 	return req, nil
 }
 
+// do authenticates and sends the request, retrying it if allowed, and decodes
+// the response body into v unless v is nil. The response is returned even if an
+// error response was received, so that callers can map status codes to their
+// own errors.
 func (c *Client) do(req *http.Request, v interface{}) (*http.Response, error) {
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if c.RateLimiter != nil {
+			if err := c.RateLimiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		key, err := c.apiKey(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(key, "")
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		start := time.Now()
+		resp, err := c.httpClient.Do(req)
+		c.logRequest(req, resp, err, time.Since(start))
+
+		if attempt < c.MaxRetries && isRetryable(req, resp, err) {
+			delay := c.retryDelay(attempt, resp)
+			if resp != nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			if err := sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return resp, c.decodeResponse(resp, v)
+	}
+}
+
+// apiKey returns the API key to authenticate the next request with.
+func (c *Client) apiKey(ctx context.Context) (string, error) {
+	if c.Credentials != nil {
+		return c.Credentials.APIKey(ctx)
 	}
+	if c.APIKey == "" {
+		return "", ErrNoCredentials
+	}
+	return c.APIKey, nil
+}
+
+func (c *Client) decodeResponse(resp *http.Response, v interface{}) error {
 	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(v)
-	return resp, err
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case resp.StatusCode == http.StatusUnprocessableEntity:
+		return parseValidationError(resp.Body)
+	case resp.StatusCode >= 400:
+		return parseAPIError(resp)
+	case v == nil:
+		return nil
+	}
+
+	err := json.NewDecoder(resp.Body).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	if err == nil && c.StrictDecoding {
+		if fields := unknownFields(v); len(fields) > 0 {
+			err = &UnknownFieldsError{Fields: fields}
+		}
+	}
+	return err
+}
+
+func (c *Client) logRequest(req *http.Request, resp *http.Response, err error, d time.Duration) {
+	if c.Logger == nil {
+		return
+	}
+	if err != nil {
+		c.Logger.Printf("billplz: %s %s failed after %v: %v", req.Method, req.URL.Path, d, err)
+		return
+	}
+	c.Logger.Printf("billplz: %s %s %d (%v)", req.Method, req.URL.Path, resp.StatusCode, d)
+}
+
+func (c *Client) retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	backoff := c.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	return backoff << uint(attempt)
+}
+
+// isRetryable reports whether a request may be sent again after the given
+// outcome. Only idempotent requests are retried.
+func isRetryable(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// sleep waits for the given duration, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,336 @@
+package billplz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a Client that sends its requests to a test server
+// serving handler.
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(server.Client(), "API_KEY", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.baseURL, err = url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCreateBillValidateSplitPayments(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate bool
+		amount   uint
+		wantErr  bool
+		wantPost int32
+	}{
+		{"disabled", false, 400, false, 1},
+		{"amount above fixed cut", true, 600, false, 1},
+		{"amount below fixed cut", true, 400, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts int32
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v3/collections/inbmmepb":
+					w.Write([]byte(`{"id":"inbmmepb","split_payment":{"email":"split@example.com","fixed_cut":500}}`))
+				case r.Method == http.MethodPost && r.URL.Path == "/v3/bills":
+					atomic.AddInt32(&posts, 1)
+					w.Write([]byte(`{"id":"8X0Iyzaw"}`))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			c.ValidateSplitPayments = tt.validate
+
+			b := validBill()
+			b.Amount = tt.amount
+			_, err := c.CreateBill(b)
+			if tt.wantErr {
+				verr, ok := err.(*ValidationError)
+				if !ok || verr.Field("split_payment.fixed_cut") == nil {
+					t.Errorf("CreateBill() = %v, want a split_payment.fixed_cut failure", err)
+				}
+			} else if err != nil {
+				t.Errorf("CreateBill() = %v, want nil", err)
+			}
+			if posts != tt.wantPost {
+				t.Errorf("bill created %d times, want %d", posts, tt.wantPost)
+			}
+		})
+	}
+}
+
+// bankAccountServer serves the bank accounts whose account number does not
+// start with "0", and fails requests for account numbers starting with "9".
+type bankAccountServer struct {
+	mu          sync.Mutex
+	requests    [][]string
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *bankAccountServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	numbers := r.URL.Query()["account_numbers[]"]
+	s.mu.Lock()
+	s.requests = append(s.requests, numbers)
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	var accounts []string
+	for _, number := range numbers {
+		if strings.HasPrefix(number, "9") {
+			http.Error(w, `{"error":{"type":"Internal","message":["failed"]}}`, http.StatusInternalServerError)
+			return
+		}
+		if !strings.HasPrefix(number, "0") {
+			accounts = append(accounts, `{"acc_no":"`+number+`","status":"verified"}`)
+		}
+	}
+	w.Write([]byte(`{"bank_verification_services":[` + strings.Join(accounts, ",") + `]}`))
+}
+
+func accountNumbers(prefix string, n int) []string {
+	numbers := make([]string, n)
+	for i := range numbers {
+		numbers[i] = fmt.Sprintf("%s%07d", prefix, i)
+	}
+	return numbers
+}
+
+func TestGetBankAccountIndex(t *testing.T) {
+	s := &bankAccountServer{}
+	c := newTestClient(t, s)
+	c.Concurrency = 2
+
+	numbers := append(accountNumbers("1", 23), "0000-0001", "12 3456 7890", "1230000-0001")
+	list, err := c.GetBankAccountIndex(numbers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes []int
+	for _, request := range s.requests {
+		sizes = append(sizes, len(request))
+	}
+	sort.Ints(sizes)
+	if fmt.Sprint(sizes) != "[6 10 10]" {
+		t.Errorf("requested chunks of %v account numbers, want [6 10 10]", sizes)
+	}
+	if s.maxInFlight > 2 {
+		t.Errorf("%d requests in flight, want at most 2", s.maxInFlight)
+	}
+	if n := len(*list.BankAccounts); n != 25 {
+		t.Errorf("got %d accounts, want 25", n)
+	}
+	if fmt.Sprint(list.NotFound) != "[0000-0001]" {
+		t.Errorf("NotFound = %q, want [0000-0001]", list.NotFound)
+	}
+}
+
+func TestGetBankAccountIndexFailure(t *testing.T) {
+	s := &bankAccountServer{}
+	c := newTestClient(t, s)
+	c.Concurrency = 1
+
+	numbers := append(append(accountNumbers("1", 10), accountNumbers("9", 10)...), accountNumbers("1", 20)[10:]...)
+	list, err := c.GetBankAccountIndexContext(context.Background(), numbers)
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("GetBankAccountIndexContext() error = %v, want a 500 *APIError", err)
+	}
+	if len(s.requests) != 2 {
+		t.Errorf("made %d requests, want the chunk after the failed one to be canceled", len(s.requests))
+	}
+	if list == nil || len(*list.BankAccounts) != 10 || len(list.NotFound) != 0 {
+		t.Errorf("got %+v, want the 10 accounts of the first chunk", list)
+	}
+}
+
+// flakyServer fails the first failures requests with the given status, and
+// records the time and body of every request.
+type flakyServer struct {
+	failures   int
+	status     int
+	retryAfter string
+
+	mu     sync.Mutex
+	times  []time.Time
+	bodies []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.times = append(s.times, time.Now())
+	s.bodies = append(s.bodies, string(body))
+	n := len(s.times)
+	s.mu.Unlock()
+
+	if n <= s.failures {
+		if s.retryAfter != "" {
+			w.Header().Set("Retry-After", s.retryAfter)
+		}
+		w.WriteHeader(s.status)
+		return
+	}
+	w.Write([]byte(`{"id":"8X0Iyzaw","payment_methods":[]}`))
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		status       int
+		call         func(c *Client) error
+		wantErr      bool
+		wantRequests int
+	}{
+		{"GET 5xx retried", 2, http.StatusServiceUnavailable,
+			func(c *Client) error { _, err := c.GetBill("8X0Iyzaw"); return err }, false, 3},
+		{"GET 429 retried", 1, http.StatusTooManyRequests,
+			func(c *Client) error { _, err := c.GetBill("8X0Iyzaw"); return err }, false, 2},
+		{"retries exhausted", 5, http.StatusInternalServerError,
+			func(c *Client) error { _, err := c.GetBill("8X0Iyzaw"); return err }, true, 3},
+		{"GET 4xx not retried", 1, http.StatusBadRequest,
+			func(c *Client) error { _, err := c.GetBill("8X0Iyzaw"); return err }, true, 1},
+		{"POST not retried", 1, http.StatusServiceUnavailable,
+			func(c *Client) error { _, err := c.CreateBill(validBill()); return err }, true, 1},
+		{"DELETE retried", 1, http.StatusBadGateway,
+			func(c *Client) error { return c.DeleteBill("8X0Iyzaw") }, false, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &flakyServer{failures: tt.failures, status: tt.status}
+			c := newTestClient(t, s)
+			c.MaxRetries = 2
+			c.RetryBackoff = time.Millisecond
+
+			err := tt.call(c)
+			if tt.wantErr {
+				if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != tt.status {
+					t.Errorf("got error %v, want a %d *APIError", err, tt.status)
+				}
+			} else if err != nil {
+				t.Errorf("got error %v, want nil", err)
+			}
+			if len(s.times) != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", len(s.times), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	s := &flakyServer{failures: 3, status: http.StatusServiceUnavailable}
+	c := newTestClient(t, s)
+	c.MaxRetries = 3
+	c.RetryBackoff = 10 * time.Millisecond
+
+	if _, err := c.GetBill("8X0Iyzaw"); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []time.Duration{10, 20, 40} {
+		if gap := s.times[i+1].Sub(s.times[i]); gap < want*time.Millisecond {
+			t.Errorf("retry %d came %v after the previous request, want at least %v", i+1, gap, want*time.Millisecond)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	s := &flakyServer{failures: 1, status: http.StatusTooManyRequests, retryAfter: "1"}
+	c := newTestClient(t, s)
+	c.MaxRetries = 1
+	c.RetryBackoff = time.Millisecond
+
+	if _, err := c.GetBill("8X0Iyzaw"); err != nil {
+		t.Fatal(err)
+	}
+	if gap := s.times[1].Sub(s.times[0]); gap < time.Second {
+		t.Errorf("retried after %v, want Retry-After's 1s", gap)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	s := &flakyServer{failures: 1, status: http.StatusServiceUnavailable}
+	c := newTestClient(t, s)
+	c.MaxRetries = 1
+	c.RetryBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Do(ctx, http.MethodGet, "/bills/8X0Iyzaw", nil, nil); err != context.DeadlineExceeded {
+		t.Errorf("Do() = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRetryRereadsBody(t *testing.T) {
+	s := &flakyServer{failures: 2, status: http.StatusServiceUnavailable}
+	c := newTestClient(t, s)
+	c.MaxRetries = 2
+	c.RetryBackoff = time.Millisecond
+
+	if _, err := c.UpdatePaymentMethods("inbmmepb", []PaymentMethodCode{PaymentMethodFPX}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.bodies) != 3 {
+		t.Fatalf("made %d requests, want 3", len(s.bodies))
+	}
+	for i, body := range s.bodies {
+		if !strings.Contains(body, `"fpx"`) || body != s.bodies[0] {
+			t.Errorf("request %d sent %q, want %q", i, body, s.bodies[0])
+		}
+	}
+}
+
+func TestRetryNetworkError(t *testing.T) {
+	var attempts int32
+	c, err := NewClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return nil, errors.New("connection reset")
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"id":"8X0Iyzaw"}`)),
+			Request:    r,
+		}, nil
+	})}, "API_KEY", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MaxRetries = 1
+	c.RetryBackoff = time.Millisecond
+
+	if _, err := c.GetBill("8X0Iyzaw"); err != nil || attempts != 2 {
+		t.Errorf("GetBill() = %v after %d attempts, want success after 2", err, attempts)
+	}
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pyrox18/billplz"
+)
+
+var commands = map[string]map[string]command{
+	"collections": {
+		"list":       {"[--page n] [--status active|inactive]", "list collections", listCollections},
+		"get":        {"<id>", "show a collection", getCollection},
+		"create":     {"--title title [split payment flags]", "create a collection", createCollection},
+		"activate":   {"<id>", "activate a collection", activateCollection},
+		"deactivate": {"<id>", "deactivate a collection", deactivateCollection},
+	},
+	"open-collections": {
+		"list":   {"[--page n] [--status active|inactive]", "list open collections", listOpenCollections},
+		"get":    {"<id>", "show an open collection", getOpenCollection},
+		"create": {"--title title --description text [flags]", "create an open collection", createOpenCollection},
+	},
+	"bills": {
+		"create": {"--collection-id id --name name --amount cents --callback-url url --description text [flags]", "create a bill", createBill},
+		"get":    {"<id>", "show a bill", getBill},
+		"delete": {"<id>", "delete a bill", deleteBill},
+	},
+	"transactions": {
+		"list": {"[--page n] [--status pending|completed|failed] <bill id>", "list the transactions of a bill", listTransactions},
+	},
+	"payment-methods": {
+		"get": {"<collection id>", "list the payment methods of a collection", getPaymentMethods},
+		"set": {"<collection id> [code...]", "enable exactly the given payment methods on a collection", setPaymentMethods},
+	},
+	"bank-accounts": {
+		"check":  {"<account number>", "check whether a bank account is verified", checkBankAccount},
+		"get":    {"<account number>", "show a bank account", getBankAccount},
+		"list":   {"<account number>...", "show several bank accounts", listBankAccounts},
+		"create": {"--name name --id-no id --acc-no number --code swift [--organization]", "register a bank account for verification", createBankAccount},
+	},
+	"webhooks": {
+		"send": {"(--bill id | --payload file)... [--key key] [--paid bool] [--state state] [--amount cents] [--bad-signature] [--repeat n] [--interval d] [--timeout d] <url>", "send signed callbacks or redirects to a URL", sendWebhooks},
+	},
+}
+
+func listCollections(e *env, args []string) error {
+	fs := e.flags(e.name)
+	page := fs.Int("page", 1, "page number")
+	status := fs.String("status", "", "only list active or inactive collections")
+	if _, err := e.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.GetCollectionIndex(*page, *status)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	if result.Collections != nil {
+		for _, col := range *result.Collections {
+			rows = append(rows, []string{col.ID, col.Title, col.Status})
+		}
+	}
+	return e.print(result, []string{"ID", "TITLE", "STATUS"}, rows)
+}
+
+func getCollection(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	col, err := c.GetCollection(args[0])
+	if err != nil {
+		return err
+	}
+	return e.printCollection(col)
+}
+
+func createCollection(e *env, args []string) error {
+	fs := e.flags(e.name)
+	title := fs.String("title", "", "collection title")
+	split := splitPaymentFlags(fs)
+	if _, err := e.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	col, err := c.CreateCollection(billplz.Collection{
+		Title:        *title,
+		SplitPayment: split(),
+	})
+	if err != nil {
+		return err
+	}
+	return e.printCollection(col)
+}
+
+func activateCollection(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	if err := c.ActivateCollection(args[0]); err != nil {
+		return err
+	}
+	return e.printMessage("Collection %s activated.", args[0])
+}
+
+func deactivateCollection(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	if err := c.DeactivateCollection(args[0]); err != nil {
+		return err
+	}
+	return e.printMessage("Collection %s deactivated.", args[0])
+}
+
+func (e *env) printCollection(col *billplz.Collection) error {
+	return e.print(col, []string{"ID", "TITLE", "STATUS"}, [][]string{{col.ID, col.Title, col.Status}})
+}
+
+func listOpenCollections(e *env, args []string) error {
+	fs := e.flags(e.name)
+	page := fs.Int("page", 1, "page number")
+	status := fs.String("status", "", "only list active or inactive open collections")
+	if _, err := e.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.GetOpenCollectionIndex(*page, *status)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	if result.OpenCollections != nil {
+		for _, o := range *result.OpenCollections {
+			rows = append(rows, openCollectionRow(&o))
+		}
+	}
+	return e.print(result, openCollectionHeaders, rows)
+}
+
+func getOpenCollection(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	o, err := c.GetOpenCollection(args[0])
+	if err != nil {
+		return err
+	}
+	return e.print(o, openCollectionHeaders, [][]string{openCollectionRow(o)})
+}
+
+func createOpenCollection(e *env, args []string) error {
+	fs := e.flags(e.name)
+	o := billplz.OpenCollection{}
+	fs.StringVar(&o.Title, "title", "", "open collection title")
+	fs.StringVar(&o.Description, "description", "", "open collection description")
+	fs.UintVar(&o.Amount, "amount", 0, "amount in cents")
+	fs.Var(optionalBool{&o.FixedAmount}, "fixed-amount", "whether the amount is fixed")
+	fs.Var(optionalUint{&o.Tax}, "tax", "tax rate in percent")
+	fs.Var(optionalBool{&o.FixedQuantity}, "fixed-quantity", "whether the quantity is fixed")
+	fs.StringVar(&o.PaymentButton, "payment-button", "", "payment button label: buy or pay")
+	fs.StringVar(&o.Reference1Label, "reference-1-label", "", "label of the first reference field")
+	fs.StringVar(&o.Reference2Label, "reference-2-label", "", "label of the second reference field")
+	fs.StringVar(&o.EmailLink, "email-link", "", "email address to link to")
+	split := splitPaymentFlags(fs)
+	if _, err := e.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	o.SplitPayment = split()
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.CreateOpenCollection(o)
+	if err != nil {
+		return err
+	}
+	return e.print(result, openCollectionHeaders, [][]string{openCollectionRow(result)})
+}
+
+var openCollectionHeaders = []string{"ID", "TITLE", "AMOUNT", "STATUS", "URL"}
+
+func openCollectionRow(o *billplz.OpenCollection) []string {
+	return []string{o.ID, o.Title, formatAmount(o.Amount), o.Status, o.URL}
+}
+
+func createBill(e *env, args []string) error {
+	fs := e.flags(e.name)
+	b := billplz.Bill{}
+	fs.StringVar(&b.CollectionID, "collection-id", "", "ID of the collection the bill belongs to")
+	fs.StringVar(&b.Name, "name", "", "name of the bill recipient")
+	fs.StringVar(&b.Email, "email", "", "email address of the bill recipient")
+	fs.StringVar(&b.Mobile, "mobile", "", "mobile number of the bill recipient")
+	fs.UintVar(&b.Amount, "amount", 0, "amount in cents")
+	fs.StringVar(&b.CallbackURL, "callback-url", "", "URL notified when the bill is paid")
+	fs.StringVar(&b.RedirectURL, "redirect-url", "", "URL the payer is redirected to after payment")
+	fs.StringVar(&b.Description, "description", "", "bill description")
+	fs.StringVar(&b.DueAt, "due-at", "", "due date, formatted as YYYY-MM-DD")
+	fs.Var(optionalBool{&b.Deliver}, "deliver", "send the bill to the recipient by email and SMS")
+	fs.StringVar(&b.Reference1Label, "reference-1-label", "", "label of the first reference")
+	fs.StringVar(&b.Reference1, "reference-1", "", "first reference")
+	fs.StringVar(&b.Reference2Label, "reference-2-label", "", "label of the second reference")
+	fs.StringVar(&b.Reference2, "reference-2", "", "second reference")
+	if _, err := e.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.CreateBill(b)
+	if err != nil {
+		return err
+	}
+	return e.printBill(result)
+}
+
+func getBill(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	b, err := c.GetBill(args[0])
+	if err != nil {
+		return err
+	}
+	return e.printBill(b)
+}
+
+func deleteBill(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	if err := c.DeleteBill(args[0]); err != nil {
+		return err
+	}
+	return e.printMessage("Bill %s deleted.", args[0])
+}
+
+func (e *env) printBill(b *billplz.Bill) error {
+	return e.print(b,
+		[]string{"ID", "COLLECTION", "STATE", "PAID", "AMOUNT", "NAME", "URL"},
+		[][]string{{b.ID, b.CollectionID, b.State, formatOptionalBool(b.Paid), formatAmount(b.Amount), b.Name, b.URL}})
+}
+
+func listTransactions(e *env, args []string) error {
+	fs := e.flags(e.name)
+	page := fs.Int("page", 1, "page number")
+	status := fs.String("status", "", "only list pending, completed or failed transactions")
+	args, err := e.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.GetBillTransactions(args[0], *page, *status)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	if result.Transactions != nil {
+		for _, t := range *result.Transactions {
+			rows = append(rows, []string{t.ID, t.Status, t.CompletedAt, t.PaymentChannel})
+		}
+	}
+	return e.print(result, []string{"ID", "STATUS", "COMPLETED AT", "CHANNEL"}, rows)
+}
+
+func getPaymentMethods(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	methods, err := c.GetPaymentMethodIndex(args[0])
+	if err != nil {
+		return err
+	}
+	return e.printPaymentMethods(methods)
+}
+
+func setPaymentMethods(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, -1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	var codes []billplz.PaymentMethodCode
+	for _, code := range args[1:] {
+		codes = append(codes, billplz.PaymentMethodCode(code))
+	}
+	changes, err := c.EnsurePaymentMethods(context.Background(), args[0], codes)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for _, code := range changes.Enabled {
+		rows = append(rows, []string{string(code), "enabled"})
+	}
+	for _, code := range changes.Disabled {
+		rows = append(rows, []string{string(code), "disabled"})
+	}
+	for _, code := range changes.Kept {
+		rows = append(rows, []string{string(code), "kept (unknown to the client)"})
+	}
+	return e.print(changes, []string{"CODE", "CHANGE"}, rows)
+}
+
+func (e *env) printPaymentMethods(methods *[]billplz.PaymentMethod) error {
+	var rows [][]string
+	if methods != nil {
+		for _, m := range *methods {
+			rows = append(rows, []string{string(m.Code), m.Name, formatOptionalBool(m.Active)})
+		}
+	}
+	return e.print(methods, []string{"CODE", "NAME", "ACTIVE"}, rows)
+}
+
+func checkBankAccount(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	verified, err := c.CheckRegistration(args[0])
+	if err != nil {
+		return err
+	}
+	result := struct {
+		AccountNumber string `json:"acc_no"`
+		Verified      bool   `json:"verified"`
+	}{args[0], verified}
+	return e.print(result, []string{"ACCOUNT NUMBER", "VERIFIED"}, [][]string{{args[0], strconv.FormatBool(verified)}})
+}
+
+func getBankAccount(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	b, err := c.GetBankAccount(args[0])
+	if err != nil {
+		return err
+	}
+	return e.print(b, bankAccountHeaders, [][]string{bankAccountRow(b)})
+}
+
+func listBankAccounts(e *env, args []string) error {
+	args, err := e.parse(e.flags(e.name), args, 1, -1)
+	if err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.GetBankAccountIndex(args)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	if result.BankAccounts != nil {
+		for _, b := range *result.BankAccounts {
+			rows = append(rows, bankAccountRow(&b))
+		}
+	}
+	for _, accountNumber := range result.NotFound {
+		rows = append(rows, []string{accountNumber, "", "", "not found", ""})
+	}
+	return e.print(result, bankAccountHeaders, rows)
+}
+
+func createBankAccount(e *env, args []string) error {
+	fs := e.flags(e.name)
+	b := billplz.BankAccount{}
+	fs.StringVar(&b.Name, "name", "", "name of the account holder")
+	fs.StringVar(&b.IDNumber, "id-no", "", "MyKad or SSM registration number of the account holder")
+	fs.StringVar(&b.AccountNumber, "acc-no", "", "bank account number")
+	fs.StringVar(&b.Code, "code", "", "SWIFT code of the bank")
+	fs.Var(optionalBool{&b.Organization}, "organization", "whether the account holder is an organization")
+	if _, err := e.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	c, err := e.client()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.CreateBankAccount(b)
+	if err != nil {
+		return err
+	}
+	return e.print(result, bankAccountHeaders, [][]string{bankAccountRow(result)})
+}
+
+var bankAccountHeaders = []string{"ACCOUNT NUMBER", "NAME", "BANK", "STATUS", "REJECT REASON"}
+
+func bankAccountRow(b *billplz.BankAccount) []string {
+	bank := b.Code
+	if info, ok := billplz.BankByCode(b.Code); ok {
+		bank = info.Name
+	}
+	return []string{b.AccountNumber, b.Name, bank, b.Status, b.RejectDescription}
+}
+
+// splitPaymentFlags registers the split payment flags on fs, and returns a
+// function building the split payment from them once fs is parsed. The split
+// payment is nil if no split flag was given, and is otherwise built even if it
+// is incomplete, so that its validation reports the missing fields.
+func splitPaymentFlags(fs *flag.FlagSet) func() *billplz.SplitPayment {
+	s := billplz.SplitPayment{}
+	fs.StringVar(&s.Email, "split-email", "", "email address of the split payment recipient")
+	fs.UintVar(&s.FixedCut, "split-fixed-cut", 0, "fixed cut of the split payment in cents")
+	fs.UintVar(&s.VariableCut, "split-variable-cut", 0, "variable cut of the split payment in percent")
+	fs.Var(optionalBool{&s.SplitHeader}, "split-header", "show the split payment recipient on the bill")
+	return func() *billplz.SplitPayment {
+		set := false
+		fs.Visit(func(f *flag.Flag) {
+			if strings.HasPrefix(f.Name, "split-") {
+				set = true
+			}
+		})
+		if !set {
+			return nil
+		}
+		return &s
+	}
+}
+
+// optionalBool is a flag.Value that sets an optional boolean field only if the
+// flag is given.
+type optionalBool struct{ p **bool }
+
+func (f optionalBool) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return formatOptionalBool(*f.p)
+}
+
+func (f optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*f.p = &v
+	return nil
+}
+
+func (f optionalBool) IsBoolFlag() bool { return true }
+
+// optionalUint is a flag.Value that sets an optional numeric field only if the
+// flag is given.
+type optionalUint struct{ p **uint }
+
+func (f optionalUint) String() string {
+	if f.p == nil || *f.p == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(**f.p), 10)
+}
+
+func (f optionalUint) Set(s string) error {
+	v, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return err
+	}
+	u := uint(v)
+	*f.p = &u
+	return nil
+}
+
+func formatOptionalBool(p *bool) string {
+	if p == nil {
+		return ""
+	}
+	return strconv.FormatBool(*p)
+}
+
+// formatAmount formats an amount in cents as ringgit.
+func formatAmount(cents uint) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
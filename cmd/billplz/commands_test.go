@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/pyrox18/billplz"
+)
+
+func TestSplitPaymentFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantNil   bool
+		wantEmail bool
+	}{
+		{"no split flags", nil, true, false},
+		{"complete", []string{"--split-email", "split@example.com", "--split-fixed-cut", "100"}, false, false},
+		{"fixed cut without email", []string{"--split-fixed-cut", "100"}, false, true},
+		{"variable cut without email", []string{"--split-variable-cut", "10"}, false, true},
+		{"split header without email", []string{"--split-header=true"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			split := splitPaymentFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			s := split()
+			if (s == nil) != tt.wantNil {
+				t.Fatalf("split payment = %+v, want nil = %v", s, tt.wantNil)
+			}
+			if s == nil {
+				return
+			}
+			verr, _ := s.Validate().(*billplz.ValidationError)
+			if got := verr != nil && verr.Field("email") != nil; got != tt.wantEmail {
+				t.Errorf("Validate() = %v, want a missing email = %v", verr, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestCreateCollectionSplitWithoutEmail(t *testing.T) {
+	t.Setenv("BILLPLZ_API_KEY", "API_KEY")
+	t.Setenv("BILLPLZ_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	var stdout, stderr bytes.Buffer
+	e := &env{stdout: &stdout, stderr: &stderr}
+	code := e.main([]string{"collections", "create", "--title", "My First API Collection", "--split-fixed-cut", "100"})
+	if code != 1 || !strings.Contains(stderr.String(), "split_payment.email") {
+		t.Errorf("exit code %d with %q, want a split_payment.email validation failure", code, stderr.String())
+	}
+}
@@ -0,0 +1,242 @@
+// Command billplz is a command-line tool for operating a Billplz account.
+//
+// Usage:
+//
+//	billplz [flags] <resource> <action> [flags] [arguments]
+//
+// The API key is read from the BILLPLZ_API_KEY environment variable, or from
+// the "api_key" field of a JSON configuration file. The configuration file
+// defaults to billplz/config.json in the user's configuration directory, and
+// may also set "sandbox" to true. An explicit --sandbox flag, such as
+// --sandbox=false, takes priority over the configuration file.
+//
+// The "webhooks send" command signs callbacks with the X-Signature key given by
+// --key, the BILLPLZ_X_SIGNATURE_KEY environment variable, or the
+// "x_signature_key" field of the configuration file.
+//
+// Run billplz without arguments to list the available commands.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pyrox18/billplz"
+)
+
+// command is a single action on a resource, such as "bills get".
+type command struct {
+	args  string
+	about string
+	run   func(e *env, args []string) error
+}
+
+var errUsage = errors.New("usage")
+
+func main() {
+	e := &env{stdout: os.Stdout, stderr: os.Stderr}
+	os.Exit(e.main(os.Args[1:]))
+}
+
+// env holds the state shared by all commands.
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+
+	sandbox    bool
+	sandboxSet bool
+	jsonOutput bool
+	configPath string
+	apiKey     string
+
+	name string
+}
+
+// config represents the structure of the configuration file.
+type config struct {
+	APIKey        string `json:"api_key"`
+	Sandbox       bool   `json:"sandbox"`
+	XSignatureKey string `json:"x_signature_key"`
+}
+
+func (e *env) main(args []string) int {
+	fs := e.flags("billplz")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	e.visit(fs)
+	args = fs.Args()
+	if len(args) < 2 {
+		e.usage()
+		return 2
+	}
+
+	actions, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(e.stderr, "billplz: unknown resource %q\n", args[0])
+		e.usage()
+		return 2
+	}
+	cmd, ok := actions[args[1]]
+	if !ok {
+		fmt.Fprintf(e.stderr, "billplz: unknown action %q for %s\n", args[1], args[0])
+		e.usage()
+		return 2
+	}
+
+	e.name = args[0] + " " + args[1]
+	err := cmd.run(e, args[2:])
+	switch {
+	case err == errUsage:
+		fmt.Fprintf(e.stderr, "usage: billplz %s %s\n", e.name, cmd.args)
+		return 2
+	case err == flag.ErrHelp:
+		return 0
+	case err != nil:
+		fmt.Fprintf(e.stderr, "billplz %s: %v\n", e.name, err)
+		return 1
+	}
+	return 0
+}
+
+func (e *env) usage() {
+	fmt.Fprintln(e.stderr, "usage: billplz [--sandbox] [--json] [--config path] <resource> <action> [flags] [arguments]")
+	fmt.Fprintln(e.stderr)
+	fmt.Fprintln(e.stderr, "commands:")
+
+	var names []string
+	for resource, actions := range commands {
+		for action := range actions {
+			names = append(names, resource+" "+action)
+		}
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(e.stderr, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		parts := strings.SplitN(name, " ", 2)
+		cmd := commands[parts[0]][parts[1]]
+		fmt.Fprintf(w, "  %s %s\t%s\n", name, cmd.args, cmd.about)
+	}
+	w.Flush()
+}
+
+// flags returns a new flag set with the global flags registered, so they can
+// be given either before or after the command name.
+func (e *env) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.BoolVar(&e.sandbox, "sandbox", e.sandbox, "use the Billplz sandbox endpoint")
+	fs.BoolVar(&e.jsonOutput, "json", e.jsonOutput, "print results as JSON")
+	fs.StringVar(&e.configPath, "config", e.configPath, "path to the configuration file")
+	return fs
+}
+
+// visit records which global flags were given explicitly in the parsed flag set.
+func (e *env) visit(fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "sandbox" {
+			e.sandboxSet = true
+		}
+	})
+}
+
+// parse parses the command's flags, and checks that the number of remaining
+// arguments is within the given bounds. A negative max means no upper bound.
+func (e *env) parse(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	e.visit(fs)
+	args = fs.Args()
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return nil, errUsage
+	}
+	return args, nil
+}
+
+// client builds a Client from the environment and the configuration file.
+func (e *env) client() (*billplz.Client, error) {
+	cfg, err := e.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := os.Getenv("BILLPLZ_API_KEY")
+	if apiKey == "" {
+		apiKey = cfg.APIKey
+	}
+	if apiKey == "" {
+		return nil, errors.New("no API key: set BILLPLZ_API_KEY or api_key in the configuration file")
+	}
+	sandbox := cfg.Sandbox
+	if e.sandboxSet {
+		sandbox = e.sandbox
+	}
+	return billplz.NewClient(nil, apiKey, sandbox)
+}
+
+func (e *env) loadConfig() (*config, error) {
+	path := e.configPath
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv("BILLPLZ_CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return &config{}, nil
+		}
+		path = filepath.Join(dir, "billplz", "config.json")
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cfg config
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+// print writes v as JSON if --json was given, and as a table of the given
+// headers and rows otherwise.
+func (e *env) print(v interface{}, headers []string, rows [][]string) error {
+	if e.jsonOutput {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// printMessage writes a confirmation message, or {"ok": true} as JSON.
+func (e *env) printMessage(format string, a ...interface{}) error {
+	if e.jsonOutput {
+		return json.NewEncoder(e.stdout).Encode(map[string]bool{"ok": true})
+	}
+	_, err := fmt.Fprintf(e.stdout, format+"\n", a...)
+	return err
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pyrox18/billplz"
+)
+
+// callbackSource is a bill ID or payload file given to "webhooks send".
+type callbackSource struct {
+	bill    string
+	payload string
+}
+
+// callbackSources is a flag.Value collecting --bill and --payload flags in the
+// order they are given.
+type callbackSources struct {
+	list    *[]callbackSource
+	payload bool
+}
+
+func (f callbackSources) String() string { return "" }
+
+func (f callbackSources) Set(s string) error {
+	if f.payload {
+		*f.list = append(*f.list, callbackSource{payload: s})
+	} else {
+		*f.list = append(*f.list, callbackSource{bill: s})
+	}
+	return nil
+}
+
+// webhookResult is the outcome of a callback sent by "webhooks send".
+type webhookResult struct {
+	BillID     string     `json:"bill_id"`
+	Paid       string     `json:"paid"`
+	State      string     `json:"state"`
+	StatusCode int        `json:"status_code,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Form       url.Values `json:"form"`
+}
+
+func sendWebhooks(e *env, args []string) error {
+	fs := e.flags(e.name)
+	var sources []callbackSource
+	fs.Var(callbackSources{list: &sources}, "bill", "build a callback from the bill with the given ID (repeatable)")
+	fs.Var(callbackSources{list: &sources, payload: true}, "payload", "read callbacks from a JSON or form-encoded file (repeatable)")
+	key := fs.String("key", "", "X-Signature key (defaults to BILLPLZ_X_SIGNATURE_KEY or x_signature_key in the configuration file)")
+	var paid *bool
+	fs.Var(optionalBool{&paid}, "paid", "override the paid field")
+	state := fs.String("state", "", "override the state field")
+	var amount *uint
+	fs.Var(optionalUint{&amount}, "amount", "override the amount and paid_amount fields, in cents")
+	badSignature := fs.Bool("bad-signature", false, "send an invalid X-Signature")
+	repeat := fs.Int("repeat", 1, "number of times the sequence of callbacks is sent")
+	interval := fs.Duration("interval", 0, "delay between two callbacks")
+	timeout := fs.Duration("timeout", 30*time.Second, "time limit for each request")
+	args, err := e.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 || *repeat < 1 {
+		return errUsage
+	}
+
+	if *key == "" {
+		*key = os.Getenv("BILLPLZ_X_SIGNATURE_KEY")
+	}
+	if *key == "" {
+		cfg, err := e.loadConfig()
+		if err != nil {
+			return err
+		}
+		*key = cfg.XSignatureKey
+	}
+	if *key == "" {
+		return errors.New("no X-Signature key: use --key, set BILLPLZ_X_SIGNATURE_KEY or x_signature_key in the configuration file")
+	}
+
+	var callbacks []url.Values
+	for _, source := range sources {
+		var values []url.Values
+		if source.bill != "" {
+			v, err := e.billCallback(source.bill)
+			if err != nil {
+				return err
+			}
+			values = []url.Values{v}
+		} else if values, err = readCallbackPayload(source.payload); err != nil {
+			return err
+		}
+		callbacks = append(callbacks, values...)
+	}
+
+	for _, values := range callbacks {
+		redirect := billplz.IsRedirect(values)
+		if paid != nil {
+			values.Set(callbackField(redirect, "paid"), strconv.FormatBool(*paid))
+		}
+		if *state != "" && !redirect {
+			values.Set("state", *state)
+		}
+		if amount != nil && !redirect {
+			values.Set("amount", strconv.FormatUint(uint64(*amount), 10))
+			values.Set("paid_amount", strconv.FormatUint(uint64(*amount), 10))
+		}
+		billplz.SignValues(*key, values)
+		if *badSignature {
+			field := callbackField(redirect, "x_signature")
+			values.Set(field, invalidSignature(values.Get(field)))
+		}
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	var results []webhookResult
+	var rows [][]string
+	for i := 0; i < *repeat*len(callbacks); i++ {
+		if i > 0 && *interval > 0 {
+			time.Sleep(*interval)
+		}
+		values := callbacks[i%len(callbacks)]
+		redirect := billplz.IsRedirect(values)
+		result := webhookResult{
+			BillID: values.Get(callbackField(redirect, "id")),
+			Paid:   values.Get(callbackField(redirect, "paid")),
+			State:  values.Get("state"),
+			Form:   values,
+		}
+		resp, err := sendCallback(client, args[0], values, redirect)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			resp.Body.Close()
+			result.StatusCode = resp.StatusCode
+		}
+		results = append(results, result)
+
+		status := result.Error
+		if status == "" {
+			status = strconv.Itoa(result.StatusCode)
+		}
+		rows = append(rows, []string{strconv.Itoa(i + 1), result.BillID, result.Paid, result.State, status})
+	}
+	return e.print(results, []string{"#", "BILL", "PAID", "STATE", "RESPONSE"}, rows)
+}
+
+// callbackField returns the name of a callback field in a callback or in the
+// query parameters of a redirect.
+func callbackField(redirect bool, name string) string {
+	if redirect {
+		return "billplz[" + name + "]"
+	}
+	return name
+}
+
+// sendCallback sends a callback as a form POST, or a redirect as a GET request
+// with the values added to the URL's query string, like Billplz does.
+func sendCallback(client *http.Client, target string, values url.Values, redirect bool) (*http.Response, error) {
+	if !redirect {
+		return client.PostForm(target, values)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	for name, vs := range values {
+		query[name] = vs
+	}
+	u.RawQuery = query.Encode()
+	return client.Get(u.String())
+}
+
+// billCallback builds the callback Billplz would send for the bill with the
+// given ID, from the bill and its latest transaction.
+func (e *env) billCallback(id string) (url.Values, error) {
+	c, err := e.client()
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.GetBill(id)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := c.GetBillTransactions(id, 1, "")
+	if err != nil {
+		return nil, err
+	}
+
+	callback := billplz.Callback{
+		ID:           b.ID,
+		CollectionID: b.CollectionID,
+		Paid:         billplz.BoolValue(b.Paid),
+		State:        b.State,
+		Amount:       b.Amount,
+		PaidAmount:   b.PaidAmount,
+		DueAt:        b.DueAt,
+		Email:        b.Email,
+		Mobile:       b.Mobile,
+		Name:         b.Name,
+		URL:          b.URL,
+	}
+	if txs.Transactions != nil && len(*txs.Transactions) > 0 {
+		tx := (*txs.Transactions)[0]
+		callback.TransactionID = tx.ID
+		callback.TransactionStatus = tx.Status
+		if callback.Paid {
+			callback.PaidAt = tx.CompletedAt
+		}
+	}
+	return callback.Values(), nil
+}
+
+// readCallbackPayload reads callbacks from a file holding either a JSON object,
+// a JSON array of objects, or a form-encoded callback body as logged by a
+// callback handler.
+func readCallbackPayload(path string) ([]url.Values, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+
+	var objects []map[string]interface{}
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		err = decodeJSON(data, &objects)
+	case bytes.HasPrefix(data, []byte("{")):
+		var object map[string]interface{}
+		err = decodeJSON(data, &object)
+		objects = append(objects, object)
+	default:
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", path, err)
+		}
+		return []url.Values{values}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+
+	callbacks := make([]url.Values, len(objects))
+	for i, object := range objects {
+		values := url.Values{}
+		for name, v := range object {
+			switch v := v.(type) {
+			case nil:
+				values.Set(name, "")
+			case string:
+				values.Set(name, v)
+			default:
+				values.Set(name, fmt.Sprint(v))
+			}
+		}
+		callbacks[i] = values
+	}
+	return callbacks, nil
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// invalidSignature returns a signature of the same form as the given one that
+// does not match it.
+func invalidSignature(signature string) string {
+	if signature == "" {
+		return "0"
+	}
+	last := "0"
+	if strings.HasSuffix(signature, "0") {
+		last = "1"
+	}
+	return signature[:len(signature)-1] + last
+}
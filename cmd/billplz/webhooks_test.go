@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pyrox18/billplz"
+)
+
+const testXSignatureKey = "S-0Sq67GFD9Y5iXmi5iXMKsA"
+
+func TestSendWebhooks(t *testing.T) {
+	callback := "id=W_79pJDk&collection_id=599&paid=false&state=due&amount=200&paid_amount=0"
+	redirect := "billplz%5Bid%5D=W_79pJDk&billplz%5Bpaid%5D=false&billplz%5Bpaid_at%5D=2015-03-09+16%3A23%3A59+%2B0800"
+
+	tests := []struct {
+		name       string
+		payload    string
+		flags      []string
+		wantMethod string
+		wantErr    error
+		wantPaid   bool
+	}{
+		{"callback", callback, nil, http.MethodPost, nil, false},
+		{"callback paid", callback, []string{"--paid=true"}, http.MethodPost, nil, true},
+		{"callback bad signature", callback, []string{"--bad-signature"}, http.MethodPost, billplz.ErrInvalidSignature, false},
+		{"redirect", redirect, nil, http.MethodGet, nil, false},
+		{"redirect paid", redirect, []string{"--paid=true"}, http.MethodGet, nil, true},
+		{"redirect bad signature", redirect, []string{"--bad-signature"}, http.MethodGet, billplz.ErrInvalidSignature, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method string
+			var parseErr error
+			var parsed *billplz.Callback
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method = r.Method
+				if r.Method == http.MethodGet {
+					parsed, parseErr = billplz.ParseRedirect(r, testXSignatureKey)
+				} else {
+					parsed, parseErr = billplz.ParseCallback(r, testXSignatureKey)
+				}
+			}))
+			defer server.Close()
+
+			path := filepath.Join(t.TempDir(), "payload")
+			if err := os.WriteFile(path, []byte(tt.payload), 0644); err != nil {
+				t.Fatal(err)
+			}
+			var stdout, stderr bytes.Buffer
+			e := &env{stdout: &stdout, stderr: &stderr}
+			args := append([]string{"webhooks", "send", "--key", testXSignatureKey, "--payload", path}, tt.flags...)
+			if code := e.main(append(args, server.URL+"/return?order=42")); code != 0 {
+				t.Fatalf("exit code %d: %s", code, stderr.String())
+			}
+
+			if method != tt.wantMethod {
+				t.Errorf("sent a %s request, want %s", method, tt.wantMethod)
+			}
+			if parseErr != tt.wantErr {
+				t.Fatalf("receiver got error %v, want %v", parseErr, tt.wantErr)
+			}
+			if parseErr == nil && parsed.Paid != tt.wantPaid {
+				t.Errorf("receiver got paid = %v, want %v", parsed.Paid, tt.wantPaid)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package billplz
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
@@ -14,23 +15,62 @@ type Collection struct {
 	Logo         *Logo         `json:"logo,omitempty"`
 	SplitPayment *SplitPayment `json:"split_payment,omitempty"`
 	Status       string        `json:"status,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by Collection.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (c *Collection) UnmarshalJSON(data []byte) error {
+	type collection Collection
+	extra, err := decodeResource(data, (*collection)(c))
+	c.Extra = extra
+	return err
 }
 
-func (c *Collection) validate() error {
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (c Collection) MarshalJSON() ([]byte, error) {
+	type collection Collection
+	return encodeResource(collection(c), c.Extra)
+}
+
+// Validate checks that the collection can be created with Client.CreateCollection.
+// The returned error is a *ValidationError if any field is invalid.
+func (c *Collection) Validate() error {
 	err := validation.Errors{
 		"title":         validation.Validate(c.Title, validation.Required),
-		"split_payment": c.SplitPayment.validate(),
+		"split_payment": c.SplitPayment.Validate(),
 	}.Filter()
-	return err
+	return newValidationError(err)
 }
 
 // CollectionIndexResult represents the structure of the response body obtained with Client.GetCollectionIndex.
 type CollectionIndexResult struct {
 	Collections *[]Collection `json:"collections,omitempty"`
 	Page        json.Number   `json:"page,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by CollectionIndexResult.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (r *CollectionIndexResult) UnmarshalJSON(data []byte) error {
+	type collectionIndexResult CollectionIndexResult
+	extra, err := decodeResource(data, (*collectionIndexResult)(r))
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (r CollectionIndexResult) MarshalJSON() ([]byte, error) {
+	type collectionIndexResult CollectionIndexResult
+	return encodeResource(collectionIndexResult(r), r.Extra)
 }
 
 // OpenCollection represents a one-off payment form.
+// FixedAmount, FixedQuantity and Tax are pointers, so that false and zero can be
+// sent explicitly, and fields missing from a response are nil. Use Bool and Uint
+// to set them.
 type OpenCollection struct {
 	ID              string        `json:"id,omitempty"`
 	Title           string        `json:"title,omitempty"`
@@ -39,27 +79,60 @@ type OpenCollection struct {
 	Reference2Label string        `json:"reference_2_label,omitempty"`
 	EmailLink       string        `json:"email_link,omitempty"`
 	Amount          uint          `json:"amount,omitempty"`
-	FixedAmount     bool          `json:"fixed_amount,omitempty"`
-	Tax             uint          `json:"tax,omitempty"`
-	FixedQuantity   bool          `json:"fixed_quantity,omitempty"`
+	FixedAmount     *bool         `json:"fixed_amount,omitempty"`
+	Tax             *uint         `json:"tax,omitempty"`
+	FixedQuantity   *bool         `json:"fixed_quantity,omitempty"`
 	PaymentButton   string        `json:"payment_button,omitempty"`
 	Photo           *Photo        `json:"photo,omitempty"`
 	SplitPayment    *SplitPayment `json:"split_payment,omitempty"`
 	URL             string        `json:"url,omitempty"`
 	Status          string        `json:"status,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by OpenCollection.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
-func (o *OpenCollection) validate() error {
-	err := validation.Errors{
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (o *OpenCollection) UnmarshalJSON(data []byte) error {
+	type openCollection OpenCollection
+	extra, err := decodeResource(data, (*openCollection)(o))
+	o.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (o OpenCollection) MarshalJSON() ([]byte, error) {
+	type openCollection OpenCollection
+	return encodeResource(openCollection(o), o.Extra)
+}
+
+// Validate checks that the open collection can be created with
+// Client.CreateOpenCollection. If the open collection has a fixed amount, its
+// split payment is checked against the amount.
+// The returned error is a *ValidationError if any field is invalid.
+func (o *OpenCollection) Validate() error {
+	errs := validation.Errors{
 		"title":             validation.Validate(o.Title, validation.Required, validation.Length(1, 50)),
 		"description":       validation.Validate(o.Description, validation.Required, validation.Length(1, 200)),
 		"reference_1_label": validation.Validate(o.Reference1Label, validation.Length(0, 20)),
 		"reference_2_label": validation.Validate(o.Reference2Label, validation.Length(0, 20)),
 		"email_link":        validation.Validate(o.EmailLink, is.Email),
 		"payment_button":    validation.Validate(o.PaymentButton, validation.In("buy", "pay")),
-		"split_payment":     o.SplitPayment.validate(),
-	}.Filter()
-	return err
+		"split_payment":     o.validateSplitPayment(),
+	}
+	if BoolValue(o.FixedAmount) {
+		errs["amount"] = validation.Validate(o.Amount, validation.Required)
+	}
+	return newValidationError(errs.Filter())
+}
+
+// validateSplitPayment validates the open collection's split payment, checking
+// its cuts against the amount if the amount is fixed.
+func (o *OpenCollection) validateSplitPayment() error {
+	if BoolValue(o.FixedAmount) && o.Amount > 0 {
+		return o.SplitPayment.ValidateAmount(o.Amount)
+	}
+	return o.SplitPayment.Validate()
 }
 
 // OpenCollectionIndexResult represents the structure of the response body obtained with
@@ -67,31 +140,166 @@ func (o *OpenCollection) validate() error {
 type OpenCollectionIndexResult struct {
 	OpenCollections *[]OpenCollection `json:"open_collections,omitempty"`
 	Page            json.Number       `json:"page,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by OpenCollectionIndexResult.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (r *OpenCollectionIndexResult) UnmarshalJSON(data []byte) error {
+	type openCollectionIndexResult OpenCollectionIndexResult
+	extra, err := decodeResource(data, (*openCollectionIndexResult)(r))
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (r OpenCollectionIndexResult) MarshalJSON() ([]byte, error) {
+	type openCollectionIndexResult OpenCollectionIndexResult
+	return encodeResource(openCollectionIndexResult(r), r.Extra)
 }
 
 // Logo represents a set of URLs to logo images for a collection.
 type Logo struct {
 	ThumbURL  string `json:"thumb_url,omitempty"`
 	AvatarURL string `json:"avatar_url,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by Logo.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (l *Logo) UnmarshalJSON(data []byte) error {
+	type logo Logo
+	extra, err := decodeResource(data, (*logo)(l))
+	l.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (l Logo) MarshalJSON() ([]byte, error) {
+	type logo Logo
+	return encodeResource(logo(l), l.Extra)
 }
 
 // Photo represents a set of URLs to images for an open collection.
 type Photo struct {
 	RetinaURL string `json:"retina_url,omitempty"`
 	AvatarURL string `json:"avatar_url,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by Photo.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (p *Photo) UnmarshalJSON(data []byte) error {
+	type photo Photo
+	extra, err := decodeResource(data, (*photo)(p))
+	p.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (p Photo) MarshalJSON() ([]byte, error) {
+	type photo Photo
+	return encodeResource(photo(p), p.Extra)
 }
 
 // SplitPayment represents data for a split payment made in collections or open collections.
+// SplitHeader is a pointer, so that false can be sent explicitly. Use Bool to set it.
 type SplitPayment struct {
 	Email       string `json:"email,omitempty"`
 	FixedCut    uint   `json:"fixed_cut,omitempty"`
 	VariableCut uint   `json:"variable_cut,omitempty"`
-	SplitHeader bool   `json:"split_header,omitempty"`
+	SplitHeader *bool  `json:"split_header,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by SplitPayment.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
-func (s *SplitPayment) validate() error {
-	err := validation.Errors{
-		"email": validation.Validate(s.Email, is.Email),
-	}.Filter()
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (s *SplitPayment) UnmarshalJSON(data []byte) error {
+	type splitPayment SplitPayment
+	extra, err := decodeResource(data, (*splitPayment)(s))
+	s.Extra = extra
 	return err
 }
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (s SplitPayment) MarshalJSON() ([]byte, error) {
+	type splitPayment SplitPayment
+	return encodeResource(splitPayment(s), s.Extra)
+}
+
+// Validate checks the fields of the split payment. A nil split payment is valid.
+// A split payment with a fixed or variable cut requires the recipient's email,
+// and the variable cut cannot exceed 100 percent.
+// The returned error is a *ValidationError if any field is invalid.
+func (s *SplitPayment) Validate() error {
+	return newValidationError(s.validate().Filter())
+}
+
+// ValidateAmount checks the split payment like Validate, and additionally checks
+// that the recipient's cut of a payment of the given amount, in cents, does not
+// exceed the amount.
+func (s *SplitPayment) ValidateAmount(amount uint) error {
+	errs := s.validate()
+	if s != nil && errs["fixed_cut"] == nil && errs["variable_cut"] == nil {
+		switch {
+		case s.FixedCut > amount:
+			errs["fixed_cut"] = newRuleError(CodeOutOfRange,
+				fmt.Sprintf("must be no greater than the amount of %d cents", amount))
+		case s.recipientCut(amount) > amount:
+			errs["fixed_cut"] = newRuleError(CodeOutOfRange,
+				fmt.Sprintf("together with the variable cut, must be no greater than the amount of %d cents", amount))
+		}
+	}
+	return newValidationError(errs.Filter())
+}
+
+func (s *SplitPayment) validate() validation.Errors {
+	if s == nil {
+		return validation.Errors{}
+	}
+	errs := validation.Errors{
+		"email":        validation.Validate(s.Email, is.Email),
+		"variable_cut": validation.Validate(s.VariableCut, validation.Max(uint(100))),
+	}
+	if s.Email == "" && (s.FixedCut > 0 || s.VariableCut > 0 || BoolValue(s.SplitHeader)) {
+		errs["email"] = newRuleError(CodeRequired, "cannot be blank if a cut or the split header is set")
+	}
+	return errs
+}
+
+// recipientCut returns the amount in cents received by the split payment's
+// recipient for a payment of the given amount. The variable cut is rounded down.
+func (s *SplitPayment) recipientCut(amount uint) uint {
+	return s.FixedCut + amount*s.VariableCut/100
+}
+
+// SplitPreview represents how a payment is shared between the collection owner
+// and the split payment recipient, as computed by SplitPayment.PreviewSplit.
+// Amounts are in cents, and do not account for Billplz transaction fees.
+type SplitPreview struct {
+	Amount          uint
+	RecipientAmount uint
+	OwnerAmount     uint
+}
+
+// PreviewSplit computes how much the collection owner and the split payment's
+// recipient would receive for a payment of the given amount, in cents. A nil
+// split payment gives the whole amount to the owner.
+// An error will be returned if the split payment is invalid for the amount.
+func (s *SplitPayment) PreviewSplit(amount uint) (*SplitPreview, error) {
+	err := s.ValidateAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &SplitPreview{Amount: amount, OwnerAmount: amount}
+	if s != nil {
+		preview.RecipientAmount = s.recipientCut(amount)
+		preview.OwnerAmount = amount - preview.RecipientAmount
+	}
+	return preview, nil
+}
@@ -1,6 +1,9 @@
 package billplz
 
-// Bank SWIFT codes supported by the Billplz API.
+import "time"
+
+// Bank SWIFT codes supported by the Billplz API. Use BankByCode to look up the
+// name and capabilities of a bank.
 //
 // Extracted from https://www.billplz.com/api#create-a-bank-account.
 const (
@@ -25,8 +28,17 @@ const (
 	BankCodeUnitedOverseasBank    = "UOVBMYKL"
 )
 
-// Base URLs for Billplz API endpoints supported by the package.
+// Base URLs for Billplz API endpoints supported by the package. The API version
+// is appended to the base URL of each request.
+const (
+	endpointStaging = "https://billplz-staging.herokuapp.com/api"
+	endpointProd    = "https://www.billplz.com/api"
+)
+
+// Limits applied to requests made by the client.
 const (
-	endpointStaging = "https://billplz-staging.herokuapp.com/api/v3"
-	endpointProdV3  = "https://www.billplz.com/api/v3"
+	defaultConcurrency        = 4
+	defaultRetryBackoff       = 500 * time.Millisecond
+	bankAccountIndexChunkSize = 10
+	defaultCacheTTL           = 5 * time.Minute
 )
@@ -0,0 +1,144 @@
+package billplz
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCredentialsCheckInterval is the default minimum delay between two
+// checks of the file read by FileCredentials.
+const defaultCredentialsCheckInterval = 5 * time.Second
+
+// CredentialsProvider supplies the API key used by a Client. It is consulted
+// before every request, so keys can be rotated without recreating the Client.
+type CredentialsProvider interface {
+	// APIKey returns the API key to authenticate the next request with, or
+	// ErrNoCredentials if no key is available.
+	APIKey(ctx context.Context) (string, error)
+}
+
+// StaticCredentials is a CredentialsProvider holding a key in memory. The key
+// can be replaced at any time with Set. It is safe for concurrent use.
+type StaticCredentials struct {
+	mu  sync.RWMutex
+	key string
+}
+
+// NewStaticCredentials instantiates and returns a StaticCredentials holding the
+// given key.
+func NewStaticCredentials(key string) *StaticCredentials {
+	return &StaticCredentials{key: key}
+}
+
+// APIKey implements CredentialsProvider.
+func (s *StaticCredentials) APIKey(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.key == "" {
+		return "", ErrNoCredentials
+	}
+	return s.key, nil
+}
+
+// Set replaces the key used by subsequent requests.
+func (s *StaticCredentials) Set(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
+}
+
+// EnvCredentials is a CredentialsProvider that reads the key from an
+// environment variable on every request.
+type EnvCredentials struct {
+	// Name is the name of the environment variable. Defaults to
+	// BILLPLZ_API_KEY.
+	Name string
+}
+
+// APIKey implements CredentialsProvider.
+func (e EnvCredentials) APIKey(ctx context.Context) (string, error) {
+	name := e.Name
+	if name == "" {
+		name = "BILLPLZ_API_KEY"
+	}
+	key := strings.TrimSpace(os.Getenv(name))
+	if key == "" {
+		return "", ErrNoCredentials
+	}
+	return key, nil
+}
+
+// FileCredentials is a CredentialsProvider that reads the key from a file, such
+// as a mounted secret, and reloads it when the file changes. Surrounding
+// whitespace is ignored. It is safe for concurrent use.
+// If the file becomes unreadable or empty, such as while it is being replaced,
+// the last key read is kept.
+type FileCredentials struct {
+	path string
+
+	// CheckInterval is the minimum delay between two checks of the file for
+	// changes. Defaults to 5 seconds.
+	CheckInterval time.Duration
+
+	mu        sync.Mutex
+	key       string
+	modTime   time.Time
+	size      int64
+	checkedAt time.Time
+}
+
+// NewFileCredentials instantiates and returns a FileCredentials reading the file
+// at the given path.
+// An error will be returned if the file cannot be read.
+func NewFileCredentials(path string) (*FileCredentials, error) {
+	f := &FileCredentials{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// APIKey implements CredentialsProvider.
+func (f *FileCredentials) APIKey(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	interval := f.CheckInterval
+	if interval <= 0 {
+		interval = defaultCredentialsCheckInterval
+	}
+	if time.Since(f.checkedAt) >= interval {
+		f.reload()
+	}
+	if f.key == "" {
+		return "", ErrNoCredentials
+	}
+	return f.key, nil
+}
+
+// reload reads the file again if it changed since it was last read. It must be
+// called with f.mu held, or before f is shared.
+func (f *FileCredentials) reload() error {
+	f.checkedAt = time.Now()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	if key := strings.TrimSpace(string(data)); key != "" {
+		f.key = key
+		f.modTime = info.ModTime()
+		f.size = info.Size()
+	}
+	return nil
+}
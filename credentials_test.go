@@ -0,0 +1,155 @@
+package billplz
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeKey writes a key file with the given modification time, so that changes
+// are detected even within the resolution of the file system's clock.
+func writeKey(t *testing.T, path, key string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// keyServer records the API key of every request it receives.
+type keyServer struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (s *keyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, _, _ := r.BasicAuth()
+	s.mu.Lock()
+	s.keys = append(s.keys, key)
+	s.mu.Unlock()
+	w.Write([]byte(`{"id":"W_79pJDk"}`))
+}
+
+func (s *keyServer) last() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.keys) == 0 {
+		return ""
+	}
+	return s.keys[len(s.keys)-1]
+}
+
+func TestFileCredentialsRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	start := time.Now().Add(-time.Hour)
+	writeKey(t, path, " first-key\n", start)
+
+	creds, err := NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.CheckInterval = time.Nanosecond
+	server := &keyServer{}
+	c := newTestClient(t, server)
+	c.APIKey = ""
+	c.Credentials = creds
+
+	if _, err := c.GetBill("W_79pJDk"); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.last(); got != "first-key" {
+		t.Errorf("authenticated with %q, want first-key", got)
+	}
+
+	// A key of the same length, so only the modification time tells them apart.
+	writeKey(t, path, "other-key", start.Add(time.Second))
+	if _, err := c.GetBill("W_79pJDk"); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.last(); got != "other-key" {
+		t.Errorf("authenticated with %q after rotation, want other-key", got)
+	}
+}
+
+func TestFileCredentialsCheckInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	start := time.Now().Add(-time.Hour)
+	writeKey(t, path, "first-key", start)
+
+	creds, err := NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.CheckInterval = time.Hour
+	writeKey(t, path, "second-key", start.Add(time.Second))
+	if key, err := creds.APIKey(context.Background()); key != "first-key" || err != nil {
+		t.Errorf("APIKey() before CheckInterval = %q, %v, want first-key", key, err)
+	}
+
+	creds.CheckInterval = time.Nanosecond
+	if key, err := creds.APIKey(context.Background()); key != "second-key" || err != nil {
+		t.Errorf("APIKey() after CheckInterval = %q, %v, want second-key", key, err)
+	}
+}
+
+func TestFileCredentialsKeepsLastKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	start := time.Now().Add(-time.Hour)
+	writeKey(t, path, "first-key", start)
+
+	creds, err := NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.CheckInterval = time.Nanosecond
+
+	writeKey(t, path, " \n", start.Add(time.Second))
+	if key, err := creds.APIKey(context.Background()); key != "first-key" || err != nil {
+		t.Errorf("APIKey() with an empty file = %q, %v, want first-key", key, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := creds.APIKey(context.Background()); key != "first-key" || err != nil {
+		t.Errorf("APIKey() with a missing file = %q, %v, want first-key", key, err)
+	}
+
+	writeKey(t, path, "second-key", start.Add(2*time.Second))
+	if key, err := creds.APIKey(context.Background()); key != "second-key" || err != nil {
+		t.Errorf("APIKey() once the file is replaced = %q, %v, want second-key", key, err)
+	}
+}
+
+func TestFileCredentialsNoKey(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewFileCredentials(filepath.Join(dir, "missing")); err == nil {
+		t.Error("NewFileCredentials() of a missing file succeeded")
+	}
+
+	path := filepath.Join(dir, "api-key")
+	writeKey(t, path, "\n", time.Now().Add(-time.Hour))
+	creds, err := NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := creds.APIKey(context.Background()); err != ErrNoCredentials {
+		t.Errorf("APIKey() with an empty file = %v, want ErrNoCredentials", err)
+	}
+
+	server := &keyServer{}
+	c := newTestClient(t, server)
+	c.Credentials = creds
+	if _, err := c.GetBill("W_79pJDk"); err != ErrNoCredentials {
+		t.Errorf("GetBill() without a key = %v, want ErrNoCredentials", err)
+	}
+	if len(server.keys) != 0 {
+		t.Errorf("sent %d requests without a key", len(server.keys))
+	}
+}
@@ -1,7 +1,11 @@
 package billplz
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 )
 
 var (
@@ -21,6 +25,19 @@ var (
 	// enabled in the user's Billplz account.
 	ErrAdminPrivilegeRequired = errors.New("billplz: admin privilege required")
 
+	// ErrWrongEnvironment is returned by Client.Ping, if Client.PingOtherEnvironment is set,
+	// if the API key is only valid for the other environment, such as a production API key
+	// used with the sandbox.
+	ErrWrongEnvironment = errors.New("billplz: API key belongs to the other environment")
+
+	// ErrUnreachable is wrapped by the error returned by Client.Ping if the API cannot be
+	// reached.
+	ErrUnreachable = errors.New("billplz: API unreachable")
+
+	// ErrNoCredentials is returned if no API key is available to authenticate a
+	// request, either in Client.APIKey or from Client.Credentials.
+	ErrNoCredentials = errors.New("billplz: no API key available")
+
 	// ErrUnauthorized is returned if an invalid API key is provided for authentication.
 	ErrUnauthorized = errors.New("billplz: invalid API authorization key")
 
@@ -28,7 +45,119 @@ var (
 	// ID is not found.
 	ErrBillNotFound = errors.New("billplz: bill not found")
 
+	// ErrBillDeleted is returned by Client.WaitForBillPaid if the bill is deleted before
+	// it is paid.
+	ErrBillDeleted = errors.New("billplz: bill deleted before being paid")
+
 	// ErrBankAccountNotFound is returned by Client.CheckRegistration if a bank
 	// account with the given account number is not found.
 	ErrBankAccountNotFound = errors.New("billplz: bank account not found")
+
+	// ErrVerificationNotFound is returned by a VerificationStore if no verification is
+	// being tracked for the given account number.
+	ErrVerificationNotFound = errors.New("billplz: bank account verification not found")
+
+	// ErrUnknownPaymentMethod is returned by Client.UpdatePaymentMethods and
+	// Client.EnsurePaymentMethods if a payment method code is not supported by the
+	// package, or is malformed if Client.AllowUnknownPaymentMethods is set.
+	ErrUnknownPaymentMethod = errors.New("billplz: unknown payment method code")
+
+	// ErrInvalidSignature is returned by ParseCallback, ParseRedirect and VerifyXSignature
+	// if the X-Signature of a callback or redirect is missing or invalid.
+	ErrInvalidSignature = errors.New("billplz: invalid X-Signature")
+
+	// ErrNoSignatureKey is returned by ParseCallback, ParseRedirect, VerifyXSignature and
+	// NewSignatureKeySet if no X-Signature key is configured, so that callbacks cannot be
+	// verified.
+	ErrNoSignatureKey = errors.New("billplz: no X-Signature key configured")
+
+	// ErrNilCallback is returned by Client.ConfirmPayment if the callback is nil.
+	ErrNilCallback = errors.New("billplz: callback is nil")
+
+	// ErrNilConfirmationService is returned by ConfirmingHandler if no
+	// PaymentConfirmationService is given.
+	ErrNilConfirmationService = errors.New("billplz: payment confirmation service is nil")
+
+	// ErrCallbackNotFound is returned by a CallbackStore if no callback with the
+	// given key was received.
+	ErrCallbackNotFound = errors.New("billplz: callback not found")
+
+	// ErrNoCallbackHandler is returned by CallbackProcessor.Run and
+	// CallbackProcessor.ProcessPending if the processor has no Handler, and by
+	// ConfirmingHandler if no handler is given.
+	ErrNoCallbackHandler = errors.New("billplz: no callback handler configured")
+
+	// ErrTenantNotFound is returned by a TenantConfigProvider if a tenant with the given ID,
+	// or owning the given collection, is not found.
+	ErrTenantNotFound = errors.New("billplz: tenant not found")
 )
+
+// UnknownFieldsError is returned by a Client with StrictDecoding enabled if a response
+// contains fields that are not modelled by the package. Fields are qualified by the name
+// of the resource they were found in, such as "Bill.paid_at".
+type UnknownFieldsError struct {
+	Fields []string
+}
+
+// Error implements the error interface.
+func (e *UnknownFieldsError) Error() string {
+	return "billplz: response contains unknown fields: " + strings.Join(e.Fields, ", ")
+}
+
+// PaymentMismatchError is returned by a handler built with ConfirmingHandler if a
+// callback claiming a bill is paid is not confirmed by the API.
+type PaymentMismatchError struct {
+	BillID     string
+	Mismatches []PaymentMismatch
+}
+
+// Error implements the error interface.
+func (e *PaymentMismatchError) Error() string {
+	parts := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		parts[i] = fmt.Sprintf("%s is %q, expected %q", m.Field, m.Actual, m.Expected)
+	}
+	return "billplz: payment of bill " + e.BillID + " not confirmed: " + strings.Join(parts, "; ")
+}
+
+// APIError is returned if the Billplz API responds with an error status that is not
+// covered by a more specific error.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Messages   []string
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("billplz: API responded with status %d", e.StatusCode)
+	if e.Type != "" {
+		msg += " (" + e.Type + ")"
+	}
+	if len(e.Messages) > 0 {
+		msg += ": " + strings.Join(e.Messages, "; ")
+	}
+	return msg
+}
+
+// joinErrors returns the first of errs, noting how many other errors occurred,
+// or nil if errs is empty.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return fmt.Errorf("%w (and %d more errors)", errs[0], len(errs)-1)
+}
+
+func parseAPIError(resp *http.Response) *APIError {
+	var r errorResponse
+	json.NewDecoder(resp.Body).Decode(&r)
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Type:       r.Error.Type,
+		Messages:   r.messages(),
+	}
+}
@@ -0,0 +1,327 @@
+package billplz
+
+import (
+	"context"
+	"sync"
+)
+
+// FakeCall records a call made to a FakeClient.
+type FakeCall struct {
+	// Method is the name of the called method, such as "CreateBill".
+	Method string
+
+	// Args holds the arguments of the call, in order.
+	Args []interface{}
+}
+
+// FakeClient is an implementation of Service for tests of code that depends on
+// the package. Every call is recorded, then answered by the matching Func field
+// if it is set. If the Func field is not set, the call succeeds with an empty
+// result.
+// A FakeClient is safe for concurrent use, as long as the Func fields are not
+// changed while it is in use.
+type FakeClient struct {
+	CreateBillFunc          func(b Bill) (*Bill, error)
+	GetBillFunc             func(id string) (*Bill, error)
+	DeleteBillFunc          func(id string) error
+	GetBillTransactionsFunc func(id string, page int, status string) (*BillTransactions, error)
+	WaitForBillPaidFunc     func(ctx context.Context, id string, opts PollOptions) (*Bill, error)
+	WatchBillsFunc          func(ctx context.Context, ids []string, opts PollOptions) <-chan BillEvent
+	GetBillsFunc            func(ctx context.Context, ids []string, opts GetBillsOptions) (map[string]BillResult, error)
+	StreamBillsFunc         func(ctx context.Context, ids []string, opts GetBillsOptions) <-chan BillResult
+	ConfirmPaymentFunc      func(ctx context.Context, callback *Callback, expected ExpectedPayment) (*PaymentConfirmation, error)
+
+	CreateCollectionFunc       func(collection Collection) (*Collection, error)
+	GetCollectionFunc          func(id string) (*Collection, error)
+	GetCollectionIndexFunc     func(page int, status string) (*CollectionIndexResult, error)
+	CreateOpenCollectionFunc   func(o OpenCollection) (*OpenCollection, error)
+	GetOpenCollectionFunc      func(id string) (*OpenCollection, error)
+	GetOpenCollectionIndexFunc func(page int, status string) (*OpenCollectionIndexResult, error)
+	DeactivateCollectionFunc   func(id string) error
+	ActivateCollectionFunc     func(id string) error
+
+	CheckRegistrationFunc   func(accountNumber string) (bool, error)
+	GetBankAccountIndexFunc func(accountNumbers []string) (*BankAccountList, error)
+	GetBankAccountFunc      func(accountNumber string) (*BankAccount, error)
+	CreateBankAccountFunc   func(b BankAccount) (*BankAccount, error)
+
+	GetPaymentMethodIndexFunc func(id string) (*[]PaymentMethod, error)
+	UpdatePaymentMethodsFunc  func(id string, codes []PaymentMethodCode) (*[]PaymentMethod, error)
+	EnsurePaymentMethodsFunc  func(ctx context.Context, collectionID string, desired []PaymentMethodCode) (*PaymentMethodChanges, error)
+
+	mu    sync.Mutex
+	calls []FakeCall
+}
+
+// Calls returns the calls made to the fake so far, in order.
+func (f *FakeClient) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// CallsTo returns the calls made to the method with the given name, in order.
+func (f *FakeClient) CallsTo(method string) []FakeCall {
+	var calls []FakeCall
+	for _, call := range f.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the calls recorded so far.
+func (f *FakeClient) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+func (f *FakeClient) record(method string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, FakeCall{Method: method, Args: args})
+}
+
+// CreateBill implements BillService.
+func (f *FakeClient) CreateBill(b Bill) (*Bill, error) {
+	f.record("CreateBill", b)
+	if f.CreateBillFunc != nil {
+		return f.CreateBillFunc(b)
+	}
+	return &Bill{}, nil
+}
+
+// GetBill implements BillService.
+func (f *FakeClient) GetBill(id string) (*Bill, error) {
+	f.record("GetBill", id)
+	return f.getBill(id)
+}
+
+// getBill returns the result of GetBill without recording a call.
+func (f *FakeClient) getBill(id string) (*Bill, error) {
+	if f.GetBillFunc != nil {
+		return f.GetBillFunc(id)
+	}
+	return &Bill{}, nil
+}
+
+// DeleteBill implements BillService.
+func (f *FakeClient) DeleteBill(id string) error {
+	f.record("DeleteBill", id)
+	if f.DeleteBillFunc != nil {
+		return f.DeleteBillFunc(id)
+	}
+	return nil
+}
+
+// GetBillTransactions implements BillService.
+func (f *FakeClient) GetBillTransactions(id string, page int, status string) (*BillTransactions, error) {
+	f.record("GetBillTransactions", id, page, status)
+	if f.GetBillTransactionsFunc != nil {
+		return f.GetBillTransactionsFunc(id, page, status)
+	}
+	return &BillTransactions{}, nil
+}
+
+// WaitForBillPaid implements BillService.
+func (f *FakeClient) WaitForBillPaid(ctx context.Context, id string, opts PollOptions) (*Bill, error) {
+	f.record("WaitForBillPaid", ctx, id, opts)
+	if f.WaitForBillPaidFunc != nil {
+		return f.WaitForBillPaidFunc(ctx, id, opts)
+	}
+	return &Bill{ID: id, Paid: Bool(true), State: "paid"}, nil
+}
+
+// WatchBills implements BillService. Without WatchBillsFunc, the returned
+// channel is closed without sending any event.
+func (f *FakeClient) WatchBills(ctx context.Context, ids []string, opts PollOptions) <-chan BillEvent {
+	f.record("WatchBills", ctx, ids, opts)
+	if f.WatchBillsFunc != nil {
+		return f.WatchBillsFunc(ctx, ids, opts)
+	}
+	events := make(chan BillEvent)
+	close(events)
+	return events
+}
+
+// GetBills implements BulkBillService. Without GetBillsFunc, each bill is
+// looked up with GetBillFunc, without recording GetBill calls.
+func (f *FakeClient) GetBills(ctx context.Context, ids []string, opts GetBillsOptions) (map[string]BillResult, error) {
+	f.record("GetBills", ctx, ids, opts)
+	if f.GetBillsFunc != nil {
+		return f.GetBillsFunc(ctx, ids, opts)
+	}
+	results := make(map[string]BillResult, len(ids))
+	for _, id := range ids {
+		b, err := f.getBill(id)
+		results[id] = BillResult{BillID: id, Bill: b, Err: err}
+	}
+	return results, nil
+}
+
+// StreamBills implements BulkBillService. Without StreamBillsFunc, each bill is
+// looked up with GetBillFunc, without recording GetBill calls, and the
+// returned channel is closed once every result is sent.
+func (f *FakeClient) StreamBills(ctx context.Context, ids []string, opts GetBillsOptions) <-chan BillResult {
+	f.record("StreamBills", ctx, ids, opts)
+	if f.StreamBillsFunc != nil {
+		return f.StreamBillsFunc(ctx, ids, opts)
+	}
+	results := make(chan BillResult, len(ids))
+	for _, id := range ids {
+		b, err := f.getBill(id)
+		results <- BillResult{BillID: id, Bill: b, Err: err}
+	}
+	close(results)
+	return results
+}
+
+// ConfirmPayment implements PaymentConfirmationService. Without
+// ConfirmPaymentFunc, every payment is confirmed.
+func (f *FakeClient) ConfirmPayment(ctx context.Context, callback *Callback, expected ExpectedPayment) (*PaymentConfirmation, error) {
+	f.record("ConfirmPayment", ctx, callback, expected)
+	if f.ConfirmPaymentFunc != nil {
+		return f.ConfirmPaymentFunc(ctx, callback, expected)
+	}
+	if callback == nil {
+		return nil, ErrNilCallback
+	}
+	return &PaymentConfirmation{Bill: &Bill{ID: callback.ID}}, nil
+}
+
+// CreateCollection implements CollectionService.
+func (f *FakeClient) CreateCollection(collection Collection) (*Collection, error) {
+	f.record("CreateCollection", collection)
+	if f.CreateCollectionFunc != nil {
+		return f.CreateCollectionFunc(collection)
+	}
+	return &Collection{}, nil
+}
+
+// GetCollection implements CollectionService.
+func (f *FakeClient) GetCollection(id string) (*Collection, error) {
+	f.record("GetCollection", id)
+	if f.GetCollectionFunc != nil {
+		return f.GetCollectionFunc(id)
+	}
+	return &Collection{}, nil
+}
+
+// GetCollectionIndex implements CollectionService.
+func (f *FakeClient) GetCollectionIndex(page int, status string) (*CollectionIndexResult, error) {
+	f.record("GetCollectionIndex", page, status)
+	if f.GetCollectionIndexFunc != nil {
+		return f.GetCollectionIndexFunc(page, status)
+	}
+	return &CollectionIndexResult{}, nil
+}
+
+// CreateOpenCollection implements CollectionService.
+func (f *FakeClient) CreateOpenCollection(o OpenCollection) (*OpenCollection, error) {
+	f.record("CreateOpenCollection", o)
+	if f.CreateOpenCollectionFunc != nil {
+		return f.CreateOpenCollectionFunc(o)
+	}
+	return &OpenCollection{}, nil
+}
+
+// GetOpenCollection implements CollectionService.
+func (f *FakeClient) GetOpenCollection(id string) (*OpenCollection, error) {
+	f.record("GetOpenCollection", id)
+	if f.GetOpenCollectionFunc != nil {
+		return f.GetOpenCollectionFunc(id)
+	}
+	return &OpenCollection{}, nil
+}
+
+// GetOpenCollectionIndex implements CollectionService.
+func (f *FakeClient) GetOpenCollectionIndex(page int, status string) (*OpenCollectionIndexResult, error) {
+	f.record("GetOpenCollectionIndex", page, status)
+	if f.GetOpenCollectionIndexFunc != nil {
+		return f.GetOpenCollectionIndexFunc(page, status)
+	}
+	return &OpenCollectionIndexResult{}, nil
+}
+
+// DeactivateCollection implements CollectionService.
+func (f *FakeClient) DeactivateCollection(id string) error {
+	f.record("DeactivateCollection", id)
+	if f.DeactivateCollectionFunc != nil {
+		return f.DeactivateCollectionFunc(id)
+	}
+	return nil
+}
+
+// ActivateCollection implements CollectionService.
+func (f *FakeClient) ActivateCollection(id string) error {
+	f.record("ActivateCollection", id)
+	if f.ActivateCollectionFunc != nil {
+		return f.ActivateCollectionFunc(id)
+	}
+	return nil
+}
+
+// CheckRegistration implements BankAccountService.
+func (f *FakeClient) CheckRegistration(accountNumber string) (bool, error) {
+	f.record("CheckRegistration", accountNumber)
+	if f.CheckRegistrationFunc != nil {
+		return f.CheckRegistrationFunc(accountNumber)
+	}
+	return false, nil
+}
+
+// GetBankAccountIndex implements BankAccountService.
+func (f *FakeClient) GetBankAccountIndex(accountNumbers []string) (*BankAccountList, error) {
+	f.record("GetBankAccountIndex", accountNumbers)
+	if f.GetBankAccountIndexFunc != nil {
+		return f.GetBankAccountIndexFunc(accountNumbers)
+	}
+	return &BankAccountList{}, nil
+}
+
+// GetBankAccount implements BankAccountService.
+func (f *FakeClient) GetBankAccount(accountNumber string) (*BankAccount, error) {
+	f.record("GetBankAccount", accountNumber)
+	if f.GetBankAccountFunc != nil {
+		return f.GetBankAccountFunc(accountNumber)
+	}
+	return &BankAccount{}, nil
+}
+
+// CreateBankAccount implements BankAccountService.
+func (f *FakeClient) CreateBankAccount(b BankAccount) (*BankAccount, error) {
+	f.record("CreateBankAccount", b)
+	if f.CreateBankAccountFunc != nil {
+		return f.CreateBankAccountFunc(b)
+	}
+	return &BankAccount{}, nil
+}
+
+// GetPaymentMethodIndex implements PaymentMethodService.
+func (f *FakeClient) GetPaymentMethodIndex(id string) (*[]PaymentMethod, error) {
+	f.record("GetPaymentMethodIndex", id)
+	if f.GetPaymentMethodIndexFunc != nil {
+		return f.GetPaymentMethodIndexFunc(id)
+	}
+	return &[]PaymentMethod{}, nil
+}
+
+// UpdatePaymentMethods implements PaymentMethodService.
+func (f *FakeClient) UpdatePaymentMethods(id string, codes []PaymentMethodCode) (*[]PaymentMethod, error) {
+	f.record("UpdatePaymentMethods", id, codes)
+	if f.UpdatePaymentMethodsFunc != nil {
+		return f.UpdatePaymentMethodsFunc(id, codes)
+	}
+	return &[]PaymentMethod{}, nil
+}
+
+// EnsurePaymentMethods implements PaymentMethodService.
+func (f *FakeClient) EnsurePaymentMethods(ctx context.Context, collectionID string, desired []PaymentMethodCode) (*PaymentMethodChanges, error) {
+	f.record("EnsurePaymentMethods", ctx, collectionID, desired)
+	if f.EnsurePaymentMethodsFunc != nil {
+		return f.EnsurePaymentMethodsFunc(ctx, collectionID, desired)
+	}
+	return &PaymentMethodChanges{}, nil
+}
@@ -0,0 +1,47 @@
+package billplz
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFakeClientBulkCalls(t *testing.T) {
+	f := &FakeClient{
+		GetBillFunc: func(id string) (*Bill, error) {
+			if id == "missing" {
+				return nil, ErrBillNotFound
+			}
+			return &Bill{ID: id}, nil
+		},
+	}
+	ids := []string{"8X0Iyzaw", "missing"}
+
+	results, err := f.GetBills(context.Background(), ids, GetBillsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["8X0Iyzaw"].Bill == nil || results["missing"].Err != ErrBillNotFound {
+		t.Errorf("GetBills() = %v", results)
+	}
+	for range f.StreamBills(context.Background(), ids, GetBillsOptions{}) {
+	}
+
+	calls := f.Calls()
+	if len(calls) != 2 || calls[0].Method != "GetBills" || calls[1].Method != "StreamBills" {
+		t.Errorf("recorded calls are %+v, want GetBills and StreamBills only", calls)
+	}
+}
+
+func TestFakeClientConfirmPaymentNilCallback(t *testing.T) {
+	f := &FakeClient{}
+	if _, err := f.ConfirmPayment(context.Background(), nil, ExpectedPayment{}); err != ErrNilCallback {
+		t.Errorf("ConfirmPayment(nil) = %v, want ErrNilCallback", err)
+	}
+	c, err := NewClient(nil, "API_KEY", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ConfirmPayment(context.Background(), nil, ExpectedPayment{}); err != ErrNilCallback {
+		t.Errorf("Client.ConfirmPayment(nil) = %v, want ErrNilCallback", err)
+	}
+}
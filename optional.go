@@ -0,0 +1,31 @@
+package billplz
+
+// Bool returns a pointer to the given value, for setting optional boolean fields
+// such as Bill.Deliver.
+func Bool(v bool) *bool {
+	return &v
+}
+
+// Uint returns a pointer to the given value, for setting optional numeric fields
+// such as OpenCollection.Tax.
+func Uint(v uint) *uint {
+	return &v
+}
+
+// BoolValue returns the value of an optional boolean field, or false if the
+// field is not set.
+func BoolValue(p *bool) bool {
+	if p == nil {
+		return false
+	}
+	return *p
+}
+
+// UintValue returns the value of an optional numeric field, or 0 if the field
+// is not set.
+func UintValue(p *uint) uint {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
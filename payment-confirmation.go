@@ -0,0 +1,164 @@
+package billplz
+
+import (
+	"context"
+	"strconv"
+)
+
+// ExpectedPayment describes the payment an application expects for a bill,
+// such as the total of the order the bill was created for. Zero fields are not
+// checked.
+type ExpectedPayment struct {
+	CollectionID string
+	Amount       uint
+}
+
+// PaymentMismatch describes a claim of a callback that is not confirmed by the
+// API, or a value that differs from the expected payment.
+type PaymentMismatch struct {
+	// Field is the name of the mismatched field, such as "amount".
+	Field string
+
+	// Expected is the value claimed by the callback, or expected by the
+	// application.
+	Expected string
+
+	// Actual is the value returned by the API.
+	Actual string
+}
+
+// PaymentConfirmation is the result of Client.ConfirmPayment.
+type PaymentConfirmation struct {
+	// Bill is the bill returned by the API.
+	Bill *Bill
+
+	// Transaction is the completed transaction of the bill, or nil if none
+	// was found.
+	Transaction *Transaction
+
+	// Mismatches lists the checks that failed.
+	Mismatches []PaymentMismatch
+}
+
+// Confirmed reports whether every check passed.
+func (c *PaymentConfirmation) Confirmed() bool {
+	return len(c.Mismatches) == 0
+}
+
+func (c *PaymentConfirmation) check(field, expected, actual string) {
+	if expected != actual {
+		c.Mismatches = append(c.Mismatches, PaymentMismatch{
+			Field:    field,
+			Expected: expected,
+			Actual:   actual,
+		})
+	}
+}
+
+// ConfirmPayment confirms that a callback claiming a bill is paid matches the
+// bill and its transactions as returned by the API, and the payment expected
+// by the application.
+// The bill must be paid in full, and must have a completed transaction, which
+// must be the callback's transaction if the callback names one. The amount and
+// collection ID of the bill must match both the callback and the expected
+// payment; they are not checked against callbacks parsed from redirects, which
+// do not carry them. Failed checks are listed in the returned PaymentConfirmation.
+// An error will be returned if the callback is nil, if the bill is not found,
+// or if any HTTP request fails.
+func (c *Client) ConfirmPayment(ctx context.Context, callback *Callback, expected ExpectedPayment) (*PaymentConfirmation, error) {
+	if callback == nil {
+		return nil, ErrNilCallback
+	}
+	b, err := c.getBill(ctx, callback.ID)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := c.findCompletedTransaction(ctx, callback.ID, callback.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PaymentConfirmation{Bill: b, Transaction: tx}
+	amount := strconv.FormatUint(uint64(b.Amount), 10)
+	result.check("paid", "true", strconv.FormatBool(BoolValue(b.Paid)))
+	result.check("paid_amount", amount, strconv.FormatUint(uint64(b.PaidAmount), 10))
+	if callback.Amount != 0 {
+		result.check("amount", strconv.FormatUint(uint64(callback.Amount), 10), amount)
+	}
+	if callback.CollectionID != "" {
+		result.check("collection_id", callback.CollectionID, b.CollectionID)
+	}
+	if expected.Amount != 0 {
+		result.check("amount", strconv.FormatUint(uint64(expected.Amount), 10), amount)
+	}
+	if expected.CollectionID != "" {
+		result.check("collection_id", expected.CollectionID, b.CollectionID)
+	}
+	switch {
+	case result.Transaction != nil:
+	case callback.TransactionID != "":
+		result.check("transaction_id", callback.TransactionID, "")
+	default:
+		result.check("transaction_status", "completed", "")
+	}
+	return result, nil
+}
+
+// findCompletedTransaction returns the completed transaction of the bill with
+// the given ID, or its most recent completed transaction if id is empty. Pages
+// of transactions are fetched until the transaction is found, or until a page
+// is empty. It returns nil if no such transaction is found.
+func (c *Client) findCompletedTransaction(ctx context.Context, billID, id string) (*Transaction, error) {
+	for page := 1; ; page++ {
+		txs, err := c.getBillTransactions(ctx, billID, page, "completed")
+		if err != nil {
+			return nil, err
+		}
+		if txs.Transactions == nil || len(*txs.Transactions) == 0 {
+			return nil, nil
+		}
+		for i, tx := range *txs.Transactions {
+			if id == "" || tx.ID == id {
+				return &(*txs.Transactions)[i], nil
+			}
+		}
+	}
+}
+
+// ConfirmingHandler returns a CallbackHandler that confirms paid callbacks with
+// ConfirmPayment before passing them to next. The expected payment of a bill is
+// looked up with expected, which may be nil to only check the callback's claims.
+// Unpaid callbacks are passed to next unchecked. A *PaymentMismatchError is
+// returned for callbacks that are not confirmed, so a CallbackProcessor retries
+// them, and eventually sets them aside for review.
+// ErrNilConfirmationService is returned if s is nil, and ErrNoCallbackHandler if
+// next is nil.
+func ConfirmingHandler(s PaymentConfirmationService, expected func(ctx context.Context, c *Callback) (ExpectedPayment, error), next CallbackHandler) (CallbackHandler, error) {
+	if s == nil {
+		return nil, ErrNilConfirmationService
+	}
+	if next == nil {
+		return nil, ErrNoCallbackHandler
+	}
+	return func(ctx context.Context, c *Callback) error {
+		if !c.Paid {
+			return next(ctx, c)
+		}
+
+		var e ExpectedPayment
+		if expected != nil {
+			var err error
+			if e, err = expected(ctx, c); err != nil {
+				return err
+			}
+		}
+		result, err := s.ConfirmPayment(ctx, c, e)
+		if err != nil {
+			return err
+		}
+		if !result.Confirmed() {
+			return &PaymentMismatchError{BillID: c.ID, Mismatches: result.Mismatches}
+		}
+		return next(ctx, c)
+	}, nil
+}
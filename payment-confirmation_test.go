@@ -0,0 +1,201 @@
+package billplz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// paymentServer serves the bill of testCallback, and its completed
+// transactions in the given pages.
+func paymentServer(t *testing.T, bill Bill, pages [][]Transaction) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/bills/" + bill.ID:
+			json.NewEncoder(w).Encode(bill)
+		case "/v3/bills/" + bill.ID + "/transactions":
+			if r.URL.Query().Get("status") != "completed" {
+				t.Errorf("listed transactions with status %q", r.URL.Query().Get("status"))
+			}
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			txs := []Transaction{}
+			if page >= 1 && page <= len(pages) {
+				txs = pages[page-1]
+			}
+			json.NewEncoder(w).Encode(BillTransactions{BillID: bill.ID, Transactions: &txs})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func paidBill() Bill {
+	return Bill{ID: "W_79pJDk", CollectionID: "599", Paid: Bool(true), State: "paid", Amount: 200, PaidAmount: 200}
+}
+
+func TestConfirmPayment(t *testing.T) {
+	completed := []Transaction{{ID: "60793D4707CD", Status: "completed"}}
+	tests := []struct {
+		name     string
+		bill     func(b *Bill)
+		pages    [][]Transaction
+		callback func(c *Callback)
+		expected ExpectedPayment
+		want     []string
+	}{
+		{"confirmed", nil, [][]Transaction{completed}, nil, ExpectedPayment{}, nil},
+		{"confirmed with expected payment", nil, [][]Transaction{completed}, nil, ExpectedPayment{CollectionID: "599", Amount: 200}, nil},
+		{"redirect without amount and collection", nil, [][]Transaction{completed}, func(c *Callback) { c.Amount, c.CollectionID = 0, "" }, ExpectedPayment{}, nil},
+		{"named transaction", nil, [][]Transaction{completed}, func(c *Callback) { c.TransactionID = "60793D4707CD" }, ExpectedPayment{}, nil},
+		{"named transaction on a later page", nil, [][]Transaction{{{ID: "A"}}, {{ID: "B"}, {ID: "60793D4707CD"}}}, func(c *Callback) { c.TransactionID = "60793D4707CD" }, ExpectedPayment{}, nil},
+
+		{"bill not paid", func(b *Bill) { b.Paid, b.State, b.PaidAmount = Bool(false), "due", 0 }, [][]Transaction{completed}, nil, ExpectedPayment{}, []string{"paid", "paid_amount"}},
+		{"bill partially paid", func(b *Bill) { b.PaidAmount = 100 }, [][]Transaction{completed}, nil, ExpectedPayment{}, []string{"paid_amount"}},
+		{"callback amount mismatch", nil, [][]Transaction{completed}, func(c *Callback) { c.Amount = 100 }, ExpectedPayment{}, []string{"amount"}},
+		{"callback collection mismatch", nil, [][]Transaction{completed}, func(c *Callback) { c.CollectionID = "600" }, ExpectedPayment{}, []string{"collection_id"}},
+		{"expected amount mismatch", nil, [][]Transaction{completed}, nil, ExpectedPayment{Amount: 20000}, []string{"amount"}},
+		{"expected collection mismatch", nil, [][]Transaction{completed}, nil, ExpectedPayment{CollectionID: "600"}, []string{"collection_id"}},
+		{"named transaction missing", nil, [][]Transaction{completed, {{ID: "B"}}}, func(c *Callback) { c.TransactionID = "60793D4707CE" }, ExpectedPayment{}, []string{"transaction_id"}},
+		{"no completed transaction", nil, nil, nil, ExpectedPayment{}, []string{"transaction_status"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := paidBill()
+			if tt.bill != nil {
+				tt.bill(&b)
+			}
+			cb := testCallback()
+			if tt.callback != nil {
+				tt.callback(cb)
+			}
+			c := newTestClient(t, paymentServer(t, b, tt.pages))
+
+			result, err := c.ConfirmPayment(context.Background(), cb, tt.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields []string
+			for _, m := range result.Mismatches {
+				fields = append(fields, m.Field)
+			}
+			if len(fields) != len(tt.want) {
+				t.Fatalf("mismatches = %+v, want %v", result.Mismatches, tt.want)
+			}
+			for i := range fields {
+				if fields[i] != tt.want[i] {
+					t.Errorf("mismatches = %+v, want %v", result.Mismatches, tt.want)
+				}
+			}
+			if result.Confirmed() != (len(tt.want) == 0) {
+				t.Errorf("Confirmed() = %v with mismatches %+v", result.Confirmed(), result.Mismatches)
+			}
+			if len(tt.want) == 0 && result.Transaction == nil {
+				t.Error("Transaction = nil, want the completed transaction")
+			}
+		})
+	}
+}
+
+func TestConfirmPaymentErrors(t *testing.T) {
+	c := newTestClient(t, paymentServer(t, paidBill(), nil))
+	if _, err := c.ConfirmPayment(context.Background(), nil, ExpectedPayment{}); err != ErrNilCallback {
+		t.Errorf("ConfirmPayment(nil) = %v, want ErrNilCallback", err)
+	}
+	cb := testCallback()
+	cb.ID = "missing"
+	if _, err := c.ConfirmPayment(context.Background(), cb, ExpectedPayment{}); err != ErrBillNotFound {
+		t.Errorf("ConfirmPayment() of a missing bill = %v, want ErrBillNotFound", err)
+	}
+}
+
+func TestConfirmingHandler(t *testing.T) {
+	completed := [][]Transaction{{{ID: "60793D4707CD", Status: "completed"}}}
+	errExpected := errors.New("order not found")
+	tests := []struct {
+		name     string
+		bill     func(b *Bill)
+		callback func(c *Callback)
+		expected func(ctx context.Context, c *Callback) (ExpectedPayment, error)
+		wantNext bool
+		wantErr  func(err error) bool
+	}{
+		{"confirmed", nil, nil, nil, true, nil},
+		{"confirmed with expected payment", nil, nil, func(ctx context.Context, c *Callback) (ExpectedPayment, error) {
+			return ExpectedPayment{Amount: 200}, nil
+		}, true, nil},
+		{"unpaid callback", func(b *Bill) { b.Paid, b.State, b.PaidAmount = Bool(false), "due", 0 }, func(c *Callback) { c.Paid = false }, nil, true, nil},
+		{"bill not paid", func(b *Bill) { b.Paid, b.State, b.PaidAmount = Bool(false), "due", 0 }, nil, nil, false, isMismatch("paid", "paid_amount")},
+		{"amount mismatch", nil, func(c *Callback) { c.Amount = 100 }, nil, false, isMismatch("amount")},
+		{"collection mismatch", nil, func(c *Callback) { c.CollectionID = "600" }, nil, false, isMismatch("collection_id")},
+		{"expected amount mismatch", nil, nil, func(ctx context.Context, c *Callback) (ExpectedPayment, error) {
+			return ExpectedPayment{Amount: 20000}, nil
+		}, false, isMismatch("amount")},
+		{"expected payment lookup fails", nil, nil, func(ctx context.Context, c *Callback) (ExpectedPayment, error) {
+			return ExpectedPayment{}, errExpected
+		}, false, func(err error) bool { return err == errExpected }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := paidBill()
+			if tt.bill != nil {
+				tt.bill(&b)
+			}
+			cb := testCallback()
+			if tt.callback != nil {
+				tt.callback(cb)
+			}
+			c := newTestClient(t, paymentServer(t, b, completed))
+
+			called := false
+			handler, err := ConfirmingHandler(c, tt.expected, func(ctx context.Context, c *Callback) error {
+				called = true
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = handler(context.Background(), cb)
+			if called != tt.wantNext {
+				t.Errorf("next called = %v, want %v", called, tt.wantNext)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("handler() = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !tt.wantErr(err) {
+				t.Errorf("handler() = %v", err)
+			}
+		})
+	}
+}
+
+// isMismatch returns a function reporting whether an error is a
+// *PaymentMismatchError for mismatches of the given fields only.
+func isMismatch(fields ...string) func(err error) bool {
+	return func(err error) bool {
+		var merr *PaymentMismatchError
+		if !errors.As(err, &merr) || merr.BillID != "W_79pJDk" || len(merr.Mismatches) != len(fields) {
+			return false
+		}
+		for i, m := range merr.Mismatches {
+			if m.Field != fields[i] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestConfirmingHandlerNilArguments(t *testing.T) {
+	next := func(ctx context.Context, c *Callback) error { return nil }
+	if _, err := ConfirmingHandler(nil, nil, next); err != ErrNilConfirmationService {
+		t.Errorf("ConfirmingHandler(nil service) = %v, want ErrNilConfirmationService", err)
+	}
+	if _, err := ConfirmingHandler(&FakeClient{}, nil, nil); err != ErrNoCallbackHandler {
+		t.Errorf("ConfirmingHandler(nil next) = %v, want ErrNoCallbackHandler", err)
+	}
+}
@@ -1,14 +1,176 @@
 package billplz
 
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// PaymentMethodCode identifies a payment method that can be enabled on a collection.
+type PaymentMethodCode string
+
+// Payment method codes supported by the Billplz API.
+const (
+	PaymentMethodFPX        PaymentMethodCode = "fpx"
+	PaymentMethodPayPal     PaymentMethodCode = "paypal"
+	PaymentMethodBoost      PaymentMethodCode = "boost"
+	PaymentMethodCreditCard PaymentMethodCode = "creditcard"
+)
+
+// Valid reports whether the code is a payment method code supported by the package.
+// The API may offer other payment methods, which are only accepted by a Client
+// with AllowUnknownPaymentMethods set.
+func (c PaymentMethodCode) Valid() bool {
+	switch c {
+	case PaymentMethodFPX, PaymentMethodPayPal, PaymentMethodBoost, PaymentMethodCreditCard:
+		return true
+	}
+	return false
+}
+
+// wellFormed reports whether the code is made of lowercase letters, digits and
+// underscores, like the codes used by the API.
+func (c PaymentMethodCode) wellFormed() bool {
+	if c == "" {
+		return false
+	}
+	for _, r := range c {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
 // PaymentMethod represents the data for a payment method related to a collection.
+// Active is nil if the API did not return it.
 type PaymentMethod struct {
-	Code   string `json:"code,omitempty"`
-	Name   string `json:"name,omitempty"`
-	Active bool   `json:"active,omitempty"`
+	Code   PaymentMethodCode `json:"code,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Active *bool             `json:"active,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by PaymentMethod.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (p *PaymentMethod) UnmarshalJSON(data []byte) error {
+	type paymentMethod PaymentMethod
+	extra, err := decodeResource(data, (*paymentMethod)(p))
+	p.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (p PaymentMethod) MarshalJSON() ([]byte, error) {
+	type paymentMethod PaymentMethod
+	return encodeResource(paymentMethod(p), p.Extra)
 }
 
 // PaymentMethodList represents the structure of payment method data that is sent to and received
 // from the Billplz API.
 type PaymentMethodList struct {
 	PaymentMethods *[]PaymentMethod `json:"payment_methods,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by PaymentMethodList.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (l *PaymentMethodList) UnmarshalJSON(data []byte) error {
+	type paymentMethodList PaymentMethodList
+	extra, err := decodeResource(data, (*paymentMethodList)(l))
+	l.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (l PaymentMethodList) MarshalJSON() ([]byte, error) {
+	type paymentMethodList PaymentMethodList
+	return encodeResource(paymentMethodList(l), l.Extra)
+}
+
+// PaymentMethodChanges represents the payment methods enabled and disabled on a
+// collection by Client.EnsurePaymentMethods.
+type PaymentMethodChanges struct {
+	Enabled  []PaymentMethodCode
+	Disabled []PaymentMethodCode
+
+	// Kept lists the active payment methods that the package does not model,
+	// which were left enabled although they were not desired. It is always
+	// empty if Client.AllowUnknownPaymentMethods is set.
+	Kept []PaymentMethodCode
+}
+
+// Changed reports whether any payment method was enabled or disabled.
+func (p *PaymentMethodChanges) Changed() bool {
+	return len(p.Enabled) > 0 || len(p.Disabled) > 0
+}
+
+// validatePaymentMethodCodes checks that every code is supported by the package,
+// or only that it is well-formed if allowUnknown is true.
+func validatePaymentMethodCodes(codes []PaymentMethodCode, allowUnknown bool) error {
+	for _, code := range codes {
+		if !code.Valid() && !(allowUnknown && code.wellFormed()) {
+			return fmt.Errorf("%w: %q", ErrUnknownPaymentMethod, code)
+		}
+	}
+	return nil
+}
+
+// unknownPaymentMethods returns the active methods in current that the package
+// does not model and that are not in desired.
+func unknownPaymentMethods(current *[]PaymentMethod, desired []PaymentMethodCode) []PaymentMethodCode {
+	if current == nil {
+		return nil
+	}
+	wanted := map[PaymentMethodCode]bool{}
+	for _, code := range desired {
+		wanted[code] = true
+	}
+	var codes []PaymentMethodCode
+	for _, method := range *current {
+		if BoolValue(method.Active) && !method.Code.Valid() && !wanted[method.Code] {
+			codes = append(codes, method.Code)
+			wanted[method.Code] = true
+		}
+	}
+	sortPaymentMethodCodes(codes)
+	return codes
+}
+
+// diffPaymentMethods computes the changes needed to go from the active methods
+// in current to the desired set of codes.
+func diffPaymentMethods(current *[]PaymentMethod, desired []PaymentMethodCode) *PaymentMethodChanges {
+	active := map[PaymentMethodCode]bool{}
+	if current != nil {
+		for _, method := range *current {
+			if BoolValue(method.Active) {
+				active[method.Code] = true
+			}
+		}
+	}
+	wanted := map[PaymentMethodCode]bool{}
+	for _, code := range desired {
+		wanted[code] = true
+	}
+
+	changes := &PaymentMethodChanges{}
+	for code := range wanted {
+		if !active[code] {
+			changes.Enabled = append(changes.Enabled, code)
+		}
+	}
+	for code := range active {
+		if !wanted[code] {
+			changes.Disabled = append(changes.Disabled, code)
+		}
+	}
+	sortPaymentMethodCodes(changes.Enabled)
+	sortPaymentMethodCodes(changes.Disabled)
+	return changes
+}
+
+func sortPaymentMethodCodes(codes []PaymentMethodCode) {
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
 }
@@ -0,0 +1,88 @@
+package billplz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestValidatePaymentMethodCodes(t *testing.T) {
+	tests := []struct {
+		codes        []PaymentMethodCode
+		allowUnknown bool
+		wantErr      bool
+	}{
+		{[]PaymentMethodCode{PaymentMethodFPX, PaymentMethodCreditCard}, false, false},
+		{[]PaymentMethodCode{"fxp", PaymentMethodCreditCard}, false, true},
+		{[]PaymentMethodCode{"duitnow_qr"}, false, true},
+		{[]PaymentMethodCode{"duitnow_qr"}, true, false},
+		{[]PaymentMethodCode{"DuitNow QR"}, true, true},
+		{[]PaymentMethodCode{""}, true, true},
+	}
+
+	for _, tt := range tests {
+		err := validatePaymentMethodCodes(tt.codes, tt.allowUnknown)
+		if tt.wantErr != (err != nil) || (err != nil && !errors.Is(err, ErrUnknownPaymentMethod)) {
+			t.Errorf("validatePaymentMethodCodes(%q, %v) = %v", tt.codes, tt.allowUnknown, err)
+		}
+	}
+}
+
+func TestEnsurePaymentMethods(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowUnknown bool
+		desired      []PaymentMethodCode
+		wantPut      string
+		wantChanges  string
+	}{
+		{"unknown kept", false, []PaymentMethodCode{PaymentMethodFPX, PaymentMethodBoost},
+			"[fpx boost duitnow_qr]", "enabled [boost] disabled [creditcard] kept [duitnow_qr]"},
+		{"unknown disabled", true, []PaymentMethodCode{PaymentMethodFPX},
+			"[fpx]", "enabled [] disabled [creditcard duitnow_qr] kept []"},
+		{"unknown desired", true, []PaymentMethodCode{PaymentMethodFPX, PaymentMethodCreditCard, "duitnow_qr"},
+			"", "enabled [] disabled [] kept []"},
+		{"unchanged apart from unknown", false, []PaymentMethodCode{PaymentMethodFPX, PaymentMethodCreditCard},
+			"", "enabled [] disabled [] kept [duitnow_qr]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var put string
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					var body struct {
+						PaymentMethods []PaymentMethod `json:"payment_methods"`
+					}
+					json.NewDecoder(r.Body).Decode(&body)
+					var codes []PaymentMethodCode
+					for _, m := range body.PaymentMethods {
+						codes = append(codes, m.Code)
+					}
+					put = fmt.Sprint(codes)
+				}
+				w.Write([]byte(`{"payment_methods":[
+					{"code":"fpx","active":true},
+					{"code":"creditcard","active":true},
+					{"code":"boost","active":false},
+					{"code":"duitnow_qr","active":true}]}`))
+			}))
+			c.AllowUnknownPaymentMethods = tt.allowUnknown
+
+			changes, err := c.EnsurePaymentMethods(context.Background(), "inbmmepb", tt.desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if put != tt.wantPut {
+				t.Errorf("sent %s, want %s", put, tt.wantPut)
+			}
+			got := fmt.Sprintf("enabled %v disabled %v kept %v", changes.Enabled, changes.Disabled, changes.Kept)
+			if got != tt.wantChanges {
+				t.Errorf("changes = %s, want %s", got, tt.wantChanges)
+			}
+		})
+	}
+}
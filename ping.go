@@ -0,0 +1,74 @@
+package billplz
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Ping makes a cheap authenticated request to check that the API can be
+// reached, and that the client's API key is valid for the client's
+// environment.
+// ErrUnauthorized is returned if the API key is invalid. If
+// PingOtherEnvironment is set, ErrWrongEnvironment is returned instead if the
+// key is only valid for the other environment, such as a production key used
+// with the sandbox. An error wrapping ErrUnreachable is returned if the request
+// fails before a response is received.
+func (c *Client) Ping(ctx context.Context) error {
+	res, err := c.ping(ctx)
+	if res != nil && res.StatusCode == http.StatusUnauthorized {
+		if c.PingOtherEnvironment && c.validInOtherEnvironment(ctx) {
+			return ErrWrongEnvironment
+		}
+		return ErrUnauthorized
+	}
+	if res == nil && err != nil && err != ErrNoCredentials && ctx.Err() == nil {
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	return err
+}
+
+// NewVerifiedClient instantiates and returns a new Client like NewClient, and
+// checks its API key with Client.Ping. To also detect keys for the other
+// environment, build the client with NewClient, set PingOtherEnvironment and
+// call Ping.
+// An error will be returned if Ping fails.
+func NewVerifiedClient(ctx context.Context, httpClient *http.Client, apiKey string, sandbox bool) (*Client, error) {
+	c, err := NewClient(httpClient, apiKey, sandbox)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Ping(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) ping(ctx context.Context) (*http.Response, error) {
+	req, err := c.newRequest(http.MethodGet, "/collections?page=1", nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req.WithContext(ctx), nil)
+}
+
+// validInOtherEnvironment reports whether the client's API key is accepted by
+// the environment the client is not configured for.
+func (c *Client) validInOtherEnvironment(ctx context.Context) bool {
+	endpoint := endpointStaging
+	if c.baseURL.String() == endpointStaging {
+		endpoint = endpointProd
+	}
+	other, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+
+	probe := *c
+	probe.baseURL = other
+	probe.MaxRetries = 0
+	probe.Logger = nil
+	_, err = probe.ping(ctx)
+	return err == nil
+}
@@ -0,0 +1,87 @@
+package billplz
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// roundTripFunc adapts a function to the http.RoundTripper interface.
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name       string
+		validHost  string // host accepting the key, or empty if none does
+		fail       bool
+		probe      bool
+		wantErr    error
+		wantWraps  error
+		wantProbed bool
+	}{
+		{name: "valid", validHost: "billplz-staging.herokuapp.com"},
+		{name: "invalid", wantErr: ErrUnauthorized},
+		{name: "other environment", validHost: "www.billplz.com", wantErr: ErrUnauthorized},
+		{name: "other environment probed", validHost: "www.billplz.com", probe: true, wantErr: ErrWrongEnvironment, wantProbed: true},
+		{name: "invalid probed", probe: true, wantErr: ErrUnauthorized, wantProbed: true},
+		{name: "unreachable", fail: true, wantWraps: ErrUnreachable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var hosts []string
+			transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				mu.Lock()
+				hosts = append(hosts, r.URL.Host)
+				mu.Unlock()
+				if tt.fail {
+					return nil, errors.New("connection refused")
+				}
+				status := http.StatusUnauthorized
+				if r.URL.Host == tt.validHost {
+					status = http.StatusOK
+				}
+				return &http.Response{
+					StatusCode: status,
+					Header:     http.Header{},
+					Body:       io.NopCloser(strings.NewReader(`{"collections":[],"page":1}`)),
+					Request:    r,
+				}, nil
+			})
+			c, err := NewClient(&http.Client{Transport: transport}, "API_KEY", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.PingOtherEnvironment = tt.probe
+
+			err = c.Ping(context.Background())
+			switch {
+			case tt.wantWraps != nil:
+				if !errors.Is(err, tt.wantWraps) {
+					t.Errorf("Ping() = %v, want an error wrapping %v", err, tt.wantWraps)
+				}
+			case err != tt.wantErr:
+				t.Errorf("Ping() = %v, want %v", err, tt.wantErr)
+			}
+
+			probed := false
+			for _, host := range hosts {
+				if host == "www.billplz.com" {
+					probed = true
+				}
+			}
+			if probed != tt.wantProbed {
+				t.Errorf("sent the key to production: %v, want %v", probed, tt.wantProbed)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package billplz
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate of requests made by a Client. A RateLimiter can be
+// shared by several clients using the same API key.
+type RateLimiter interface {
+	// Wait blocks until a request may be made, or until ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// NewRateLimiter returns a RateLimiter that lets requests proceed at most once
+// per interval. It is safe for concurrent use.
+func NewRateLimiter(interval time.Duration) RateLimiter {
+	return newRateLimiter(interval)
+}
+
+// rateLimiter spaces out callers of Wait so that they proceed at most once
+// per interval.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(interval time.Duration) *rateLimiter {
+	return &rateLimiter{interval: interval}
+}
+
+// Wait implements RateLimiter.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	t := l.next
+	if t.Before(now) {
+		t = now
+	}
+	l.next = t.Add(l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
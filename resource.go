@@ -0,0 +1,178 @@
+package billplz
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// knownFields caches the JSON field names of resource types, keyed by type.
+var knownFields sync.Map
+
+// jsonFieldNames returns the lower-cased JSON names of the fields of the struct
+// type t, matching encoding/json's case-insensitive decoding.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	if names, ok := knownFields.Load(t); ok {
+		return names.(map[string]bool)
+	}
+
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	knownFields.Store(t, names)
+	return names
+}
+
+// decodeResource unmarshals data into v, which must be a pointer to a struct
+// without custom JSON methods, and returns the fields of data that do not map
+// to a field of the struct.
+func decodeResource(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	known := jsonFieldNames(reflect.TypeOf(v).Elem())
+	for name := range fields {
+		if known[strings.ToLower(name)] {
+			delete(fields, name)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// encodeResource marshals v, and adds the fields in extra that are not already
+// set by v.
+func encodeResource(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// withoutExtra returns a copy of v in which the Extra field of every resource
+// reachable from v is nil, so that a decoded resource can be sent back to the
+// API without the fields set by the server. Maps and interfaces are not
+// descended into.
+func withoutExtra(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return copyWithoutExtra(reflect.ValueOf(v)).Interface()
+}
+
+func copyWithoutExtra(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyWithoutExtra(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyWithoutExtra(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			switch {
+			case f.PkgPath != "":
+			case f.Name == "Extra" && f.Type == extraType:
+				c.Field(i).Set(reflect.Zero(extraType))
+			default:
+				c.Field(i).Set(copyWithoutExtra(v.Field(i)))
+			}
+		}
+		return c
+	}
+	return v
+}
+
+// unknownFields returns the names of the fields captured in the Extra field of
+// every resource reachable from v, qualified by the resource's type name.
+func unknownFields(v interface{}) []string {
+	seen := map[string]bool{}
+	collectUnknownFields(reflect.ValueOf(v), seen)
+
+	fields := make([]string, 0, len(seen))
+	for name := range seen {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+var extraType = reflect.TypeOf(map[string]json.RawMessage(nil))
+
+func collectUnknownFields(v reflect.Value, seen map[string]bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectUnknownFields(v.Elem(), seen)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectUnknownFields(v.Index(i), seen)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if f.Name == "Extra" && f.Type == extraType {
+				for _, key := range v.Field(i).MapKeys() {
+					seen[t.Name()+"."+key.String()] = true
+				}
+				continue
+			}
+			collectUnknownFields(v.Field(i), seen)
+		}
+	}
+}
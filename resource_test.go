@@ -0,0 +1,156 @@
+package billplz
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrictDecoding(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		call func(c *Client) error
+		want []string
+	}{
+		{
+			name: "known fields",
+			body: `{"bill_id":"8X0Iyzaw","transactions":[{"id":"60793D4707CD","status":"completed"}],"page":1}`,
+			call: func(c *Client) error { _, err := c.GetBillTransactions("8X0Iyzaw", 1, ""); return err },
+		},
+		{
+			name: "unknown leaf field",
+			body: `{"bill_id":"8X0Iyzaw","transactions":[{"id":"60793D4707CD","fee":150}],"page":1}`,
+			call: func(c *Client) error { _, err := c.GetBillTransactions("8X0Iyzaw", 1, ""); return err },
+			want: []string{"Transaction.fee"},
+		},
+		{
+			name: "unknown wrapper field",
+			body: `{"bill_id":"8X0Iyzaw","transactions":[],"page":1,"total_pages":3}`,
+			call: func(c *Client) error { _, err := c.GetBillTransactions("8X0Iyzaw", 1, ""); return err },
+			want: []string{"BillTransactions.total_pages"},
+		},
+		{
+			name: "unknown collection index field",
+			body: `{"collections":[],"page":1,"next_page":2}`,
+			call: func(c *Client) error { _, err := c.GetCollectionIndex(1, ""); return err },
+			want: []string{"CollectionIndexResult.next_page"},
+		},
+		{
+			name: "unknown payment method list field",
+			body: `{"payment_methods":[],"count":0}`,
+			call: func(c *Client) error { _, err := c.GetPaymentMethodIndex("inbmmepb"); return err },
+			want: []string{"PaymentMethodList.count"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			c.StrictDecoding = true
+
+			err := tt.call(c)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("got error %v, want nil", err)
+				}
+				return
+			}
+			uerr, ok := err.(*UnknownFieldsError)
+			if !ok {
+				t.Fatalf("got error %v, want an *UnknownFieldsError", err)
+			}
+			if !reflect.DeepEqual(uerr.Fields, tt.want) {
+				t.Errorf("unknown fields are %v, want %v", uerr.Fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtraNotSent(t *testing.T) {
+	var b Bill
+	err := json.Unmarshal([]byte(`{"id":"8X0Iyzaw","collection_id":"inbmmepb","amount":200,"url":"https://www.billplz.com/bills/8X0Iyzaw","server_only":true}`), &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Extra["server_only"]; !ok {
+		t.Fatalf("Extra is %v, want server_only", b.Extra)
+	}
+
+	var sent string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sent = string(body)
+		w.Write([]byte(`{}`))
+	}))
+	b.ID = ""
+	b.URL = ""
+	b.Email = "api@billplz.com"
+	b.Name = "Michael Yap"
+	b.CallbackURL = "http://example.com/webhook/"
+	b.Description = "Maecenas eu placerat ante."
+	if _, err := c.CreateBill(b); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sent, "server_only") {
+		t.Errorf("request body %s contains a field from Extra", sent)
+	}
+	if _, ok := b.Extra["server_only"]; !ok {
+		t.Errorf("sending the bill cleared its Extra field")
+	}
+}
+
+func TestExtraRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		data string
+	}{
+		{"bill", &Bill{}, `{"id":"x","reference_1":"a","paid_at":"2020"}`},
+		{"nested", &Collection{}, `{"id":"inbmmepb","logo":{"thumb_url":"t","tiny_url":"u"},"split_payment":{"email":"split@example.com","stack_order":1}}`},
+		{"wrapper", &BillTransactions{}, `{"bill_id":"8X0Iyzaw","transactions":[{"id":"60793D4707CD","fee":150}],"total_pages":3}`},
+		{"bank account", &BankAccount{}, `{"acc_no":"123456789012","status":"verified","verified_at":"2020-01-01"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(tt.data), tt.v); err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			json.Unmarshal(data, &got)
+			json.Unmarshal([]byte(tt.data), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("re-marshalled %s, want %s", data, tt.data)
+			}
+		})
+	}
+}
+
+func TestWithoutExtra(t *testing.T) {
+	methods := []PaymentMethod{{Code: PaymentMethodFPX, Extra: map[string]json.RawMessage{"fee": []byte("1")}}}
+	body := PaymentMethodList{PaymentMethods: &methods, Extra: map[string]json.RawMessage{"count": []byte("1")}}
+
+	data, err := json.Marshal(withoutExtra(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"payment_methods":[{"code":"fpx"}]}` {
+		t.Errorf("encoded %s", data)
+	}
+	if body.Extra == nil || methods[0].Extra == nil {
+		t.Error("withoutExtra modified its argument")
+	}
+	if got := withoutExtra(map[string]int{"amount": 200}); !reflect.DeepEqual(got, map[string]int{"amount": 200}) {
+		t.Errorf("withoutExtra(map) = %v", got)
+	}
+}
@@ -0,0 +1,72 @@
+package billplz
+
+import "context"
+
+// BillService groups the operations on bills and their transactions.
+type BillService interface {
+	CreateBill(b Bill) (*Bill, error)
+	GetBill(id string) (*Bill, error)
+	DeleteBill(id string) error
+	GetBillTransactions(id string, page int, status string) (*BillTransactions, error)
+	WaitForBillPaid(ctx context.Context, id string, opts PollOptions) (*Bill, error)
+	WatchBills(ctx context.Context, ids []string, opts PollOptions) <-chan BillEvent
+}
+
+// BulkBillService groups the operations that fetch many bills at once.
+type BulkBillService interface {
+	GetBills(ctx context.Context, ids []string, opts GetBillsOptions) (map[string]BillResult, error)
+	StreamBills(ctx context.Context, ids []string, opts GetBillsOptions) <-chan BillResult
+}
+
+// PaymentConfirmationService groups the operations that confirm payments
+// claimed by callbacks.
+type PaymentConfirmationService interface {
+	ConfirmPayment(ctx context.Context, callback *Callback, expected ExpectedPayment) (*PaymentConfirmation, error)
+}
+
+// CollectionService groups the operations on collections and open collections.
+type CollectionService interface {
+	CreateCollection(collection Collection) (*Collection, error)
+	GetCollection(id string) (*Collection, error)
+	GetCollectionIndex(page int, status string) (*CollectionIndexResult, error)
+	CreateOpenCollection(o OpenCollection) (*OpenCollection, error)
+	GetOpenCollection(id string) (*OpenCollection, error)
+	GetOpenCollectionIndex(page int, status string) (*OpenCollectionIndexResult, error)
+	DeactivateCollection(id string) error
+	ActivateCollection(id string) error
+}
+
+// BankAccountService groups the operations on bank accounts.
+type BankAccountService interface {
+	CheckRegistration(accountNumber string) (bool, error)
+	GetBankAccountIndex(accountNumbers []string) (*BankAccountList, error)
+	GetBankAccount(accountNumber string) (*BankAccount, error)
+	CreateBankAccount(b BankAccount) (*BankAccount, error)
+}
+
+// PaymentMethodService groups the operations on the payment methods of collections.
+type PaymentMethodService interface {
+	GetPaymentMethodIndex(id string) (*[]PaymentMethod, error)
+	UpdatePaymentMethods(id string, codes []PaymentMethodCode) (*[]PaymentMethod, error)
+	EnsurePaymentMethods(ctx context.Context, collectionID string, desired []PaymentMethodCode) (*PaymentMethodChanges, error)
+}
+
+// Service groups the operations on the API's resources. It is implemented by
+// Client, and by FakeClient for tests. Operations added later are grouped in
+// their own interfaces, such as BulkBillService, so that existing
+// implementations of Service keep compiling.
+type Service interface {
+	BillService
+	CollectionService
+	BankAccountService
+	PaymentMethodService
+}
+
+var (
+	_ Service                    = (*Client)(nil)
+	_ BulkBillService            = (*Client)(nil)
+	_ PaymentConfirmationService = (*Client)(nil)
+	_ Service                    = (*FakeClient)(nil)
+	_ BulkBillService            = (*FakeClient)(nil)
+	_ PaymentConfirmationService = (*FakeClient)(nil)
+)
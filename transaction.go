@@ -8,6 +8,23 @@ type Transaction struct {
 	Status         string `json:"status,omitempty"`
 	CompletedAt    string `json:"completed_at,omitempty"`
 	PaymentChannel string `json:"payment_channel,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by Transaction.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	type transaction Transaction
+	extra, err := decodeResource(data, (*transaction)(t))
+	t.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	type transaction Transaction
+	return encodeResource(transaction(t), t.Extra)
 }
 
 // BillTransactions represent the structure of a list of transactions received from the Billplz API.
@@ -15,4 +32,21 @@ type BillTransactions struct {
 	BillID       string         `json:"bill_id,omitempty"`
 	Transactions *[]Transaction `json:"transactions,omitempty"`
 	Page         json.Number    `json:"page,omitempty"`
+
+	// Extra holds the fields returned by the API that are not modelled by BillTransactions.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping unrecognised fields in Extra.
+func (b *BillTransactions) UnmarshalJSON(data []byte) error {
+	type billTransactions BillTransactions
+	extra, err := decodeResource(data, (*billTransactions)(b))
+	b.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, including the fields in Extra.
+func (b BillTransactions) MarshalJSON() ([]byte, error) {
+	type billTransactions BillTransactions
+	return encodeResource(billTransactions(b), b.Extra)
 }
@@ -0,0 +1,197 @@
+package billplz
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-ozzo/ozzo-validation"
+)
+
+// Codes identifying the reason a field failed validation. They are stable, and
+// can be mapped to application-specific errors.
+const (
+	CodeRequired      = "required"
+	CodeInvalid       = "invalid"
+	CodeInvalidFormat = "invalid_format"
+	CodeInvalidLength = "invalid_length"
+	CodeInvalidValue  = "invalid_value"
+	CodeInvalidEmail  = "invalid_email"
+	CodeInvalidURL    = "invalid_url"
+	CodeInvalidDate   = "invalid_date"
+	CodeOutOfRange    = "out_of_range"
+)
+
+// ValidationError is returned when a resource fails validation, either by one of
+// the Validate methods before a request is sent, or by the Billplz API in a 422
+// response.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// FieldError represents a single validation failure.
+type FieldError struct {
+	// Field is the JSON name of the invalid field. Fields of nested resources
+	// are separated by dots, such as "split_payment.email". Field is empty for
+	// errors returned by the API, which are not tied to a field.
+	Field string
+
+	// Code is one of the Code constants, identifying the kind of failure.
+	Code string
+
+	// Message is a human-readable description of the failure.
+	Message string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Message
+		if f.Field != "" {
+			parts[i] = f.Field + ": " + f.Message
+		}
+	}
+	return "billplz: validation failed: " + strings.Join(parts, "; ")
+}
+
+// Field returns the failure of the field with the given name, or nil if the field
+// is valid.
+func (e *ValidationError) Field(name string) *FieldError {
+	for i := range e.Fields {
+		if e.Fields[i].Field == name {
+			return &e.Fields[i]
+		}
+	}
+	return nil
+}
+
+// ruleFunc adapts a function to the validation.Rule interface.
+type ruleFunc func(value interface{}) error
+
+func (f ruleFunc) Validate(value interface{}) error {
+	return f(value)
+}
+
+// ruleError is an error returned by the package's own validation rules,
+// carrying one of the Code constants.
+type ruleError struct {
+	code    string
+	message string
+}
+
+func newRuleError(code, message string) error {
+	return &ruleError{code, message}
+}
+
+func (e *ruleError) Error() string {
+	return e.message
+}
+
+// ruleMessageCodes maps the messages of the ozzo-validation rules used by the
+// package to their codes.
+var ruleMessageCodes = []struct {
+	prefix string
+	code   string
+}{
+	{"cannot be blank", CodeRequired},
+	{"the length must be", CodeInvalidLength},
+	{"must be in a valid format", CodeInvalidFormat},
+	{"must be a valid value", CodeInvalidValue},
+	{"must be a valid date", CodeInvalidDate},
+	{"must be a valid email address", CodeInvalidEmail},
+	{"must be a valid URL", CodeInvalidURL},
+	{"must be no less than", CodeOutOfRange},
+	{"must be no greater than", CodeOutOfRange},
+}
+
+func ruleErrorCode(err error) string {
+	if e, ok := err.(*ruleError); ok {
+		return e.code
+	}
+	for _, m := range ruleMessageCodes {
+		if strings.HasPrefix(err.Error(), m.prefix) {
+			return m.code
+		}
+	}
+	return CodeInvalid
+}
+
+// newValidationError converts the result of validation.Errors.Filter into a
+// ValidationError. It returns nil if err is nil.
+func newValidationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	errs, ok := err.(validation.Errors)
+	if !ok {
+		return err
+	}
+
+	v := &ValidationError{}
+	v.add("", errs)
+	sort.SliceStable(v.Fields, func(i, j int) bool {
+		return v.Fields[i].Field < v.Fields[j].Field
+	})
+	return v
+}
+
+func (e *ValidationError) add(prefix string, errs validation.Errors) {
+	for field, err := range errs {
+		switch err := err.(type) {
+		case validation.Errors:
+			e.add(prefix+field+".", err)
+		case *ValidationError:
+			for _, f := range err.Fields {
+				f.Field = prefix + field + "." + f.Field
+				e.Fields = append(e.Fields, f)
+			}
+		default:
+			e.Fields = append(e.Fields, FieldError{
+				Field:   prefix + field,
+				Code:    ruleErrorCode(err),
+				Message: err.Error(),
+			})
+		}
+	}
+}
+
+// errorResponse represents the structure of an error response body returned by
+// the Billplz API. The message is either a string or a list of strings.
+type errorResponse struct {
+	Error struct {
+		Type    string          `json:"type"`
+		Message json.RawMessage `json:"message"`
+	} `json:"error"`
+}
+
+// messages returns the messages in the error response.
+func (r *errorResponse) messages() []string {
+	var list []string
+	if json.Unmarshal(r.Error.Message, &list) == nil {
+		return list
+	}
+	var message string
+	if json.Unmarshal(r.Error.Message, &message) == nil && message != "" {
+		return []string{message}
+	}
+	return nil
+}
+
+// parseValidationError converts the body of a 422 response into a ValidationError.
+func parseValidationError(body io.Reader) *ValidationError {
+	var r errorResponse
+	json.NewDecoder(body).Decode(&r)
+
+	messages := r.messages()
+	if len(messages) == 0 {
+		messages = []string{http.StatusText(http.StatusUnprocessableEntity)}
+	}
+	v := &ValidationError{}
+	for _, message := range messages {
+		v.Fields = append(v.Fields, FieldError{Code: CodeInvalid, Message: message})
+	}
+	return v
+}
@@ -0,0 +1,135 @@
+package billplz
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestValidateCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate func() error
+		want     map[string]string
+	}{
+		{"collection", func() error {
+			c := Collection{SplitPayment: &SplitPayment{Email: "not an email", VariableCut: 101}}
+			return c.Validate()
+		}, map[string]string{
+			"title":                      CodeRequired,
+			"split_payment.email":        CodeInvalidEmail,
+			"split_payment.variable_cut": CodeOutOfRange,
+		}},
+		{"split payment cut without email", func() error {
+			c := Collection{Title: "My First API Collection", SplitPayment: &SplitPayment{FixedCut: 100}}
+			return c.Validate()
+		}, map[string]string{
+			"split_payment.email": CodeRequired,
+		}},
+		{"open collection", func() error {
+			o := OpenCollection{
+				Title:         "My First API Open Collection",
+				Description:   "Maecenas eu placerat ante.",
+				PaymentButton: "donate",
+				FixedAmount:   Bool(true),
+				Amount:        500,
+				SplitPayment:  &SplitPayment{Email: "split@example.com", FixedCut: 600},
+			}
+			return o.Validate()
+		}, map[string]string{
+			"payment_button":          CodeInvalidValue,
+			"split_payment.fixed_cut": CodeOutOfRange,
+		}},
+		{"bill", func() error {
+			b := validBill()
+			b.CallbackURL = "not a url"
+			b.Reference1Label = "a label longer than twenty characters"
+			return b.Validate()
+		}, map[string]string{
+			"callback_url":      CodeInvalidURL,
+			"reference_1_label": CodeInvalidLength,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verr, ok := tt.validate().(*ValidationError)
+			if !ok {
+				t.Fatalf("Validate() did not return a *ValidationError")
+			}
+			if len(verr.Fields) != len(tt.want) {
+				t.Errorf("Validate() = %v, want %d failures", verr, len(tt.want))
+			}
+			for field, code := range tt.want {
+				if f := verr.Field(field); f == nil || f.Code != code {
+					t.Errorf("Validate() = %v, want %s to fail with %s", verr, field, code)
+				}
+			}
+			for i := 1; i < len(verr.Fields); i++ {
+				if verr.Fields[i-1].Field > verr.Fields[i].Field {
+					t.Errorf("fields are not sorted: %v", verr.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationErrorFromAPI(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+		wantMsg []string
+	}{
+		{"rejected account", http.StatusUnprocessableEntity,
+			`{"error":{"type":"Unprocessable Entity","message":["Acc no is invalid","Name is too long"]}}`,
+			nil, []string{"Acc no is invalid", "Name is too long"}},
+		{"single message", http.StatusUnprocessableEntity,
+			`{"error":{"type":"Unprocessable Entity","message":"Code is not supported"}}`,
+			nil, []string{"Code is not supported"}},
+		{"empty body", http.StatusUnprocessableEntity, ``, nil, []string{"Unprocessable Entity"}},
+		{"admin setting disabled", http.StatusUnprocessableEntity,
+			`{"error":{"type":"Unauthorized","message":"You need to enable the ADMIN setting"}}`,
+			ErrAdminPrivilegeRequired, nil},
+		{"unauthorized", http.StatusUnauthorized, ``, ErrAdminPrivilegeRequired, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+
+			_, err := c.CreateBankAccount(validBankAccount())
+			if tt.wantErr != nil {
+				if err != tt.wantErr {
+					t.Errorf("CreateBankAccount() = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("CreateBankAccount() = %v, want a *ValidationError", err)
+			}
+			if len(verr.Fields) != len(tt.wantMsg) {
+				t.Fatalf("CreateBankAccount() = %v, want %d failures", verr, len(tt.wantMsg))
+			}
+			for i, f := range verr.Fields {
+				if f.Field != "" || f.Code != CodeInvalid || f.Message != tt.wantMsg[i] {
+					t.Errorf("failure %d = %+v, want message %q", i, f, tt.wantMsg[i])
+				}
+			}
+
+			if _, err := c.GetBankAccount("123456789012"); err == ErrAdminPrivilegeRequired {
+				t.Errorf("GetBankAccount() = %v, want the API's validation error", err)
+			}
+			if err := c.Do(context.Background(), http.MethodPost, "/bills", nil, nil); err == nil {
+				t.Error("Do() = nil, want a *ValidationError")
+			} else if _, ok := err.(*ValidationError); !ok {
+				t.Errorf("Do() = %v, want a *ValidationError", err)
+			}
+		})
+	}
+}